@@ -1,17 +1,17 @@
 module github.com/handy-common-utils/ls-having
 
-go 1.19
+go 1.23
 
 require github.com/gobwas/glob v0.2.3
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/josephvusich/go-getopt v1.0.0
 	github.com/stretchr/testify v1.11.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	golang.org/x/exp v0.0.0-20230124195608-d38c7dcee874
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,34 @@
+package lsh
+
+// Matcher requiring any of the ancestors of the directory to match the matcher.
+// Ancestors are those returned by Candidate.Ancestors, and they are evaluated from the parent directory upward.
+func AncestorMatcher(matcher Matcher) Matcher {
+	return MatcherFunc(func(dir *Candidate) (bool, error) {
+		for _, ancestor := range dir.Ancestors() {
+			if matched, err := matcher.Match(ancestor); err != nil || matched {
+				return matched, err
+			}
+		}
+		return false, nil
+	})
+}
+
+// Matcher requiring the nearest ancestor matching the selector to match the condition too.
+// For example, NearestAncestorMatcher(FlagFilesMatcher(globs, false), CheckClauseMatcher(clause))
+// requires the nearest ancestor having package.json to have "private": true in it,
+// if globs has just "package.json" and clause checks package.json against `"private":\s*true`.
+// It does not match if no ancestor matches the selector.
+func NearestAncestorMatcher(selector, condition Matcher) Matcher {
+	return MatcherFunc(func(dir *Candidate) (bool, error) {
+		for _, ancestor := range dir.Ancestors() {
+			selected, err := selector.Match(ancestor)
+			if err != nil {
+				return false, err
+			}
+			if selected {
+				return condition.Match(ancestor)
+			}
+		}
+		return false, nil
+	})
+}
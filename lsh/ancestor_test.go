@@ -0,0 +1,98 @@
+package lsh
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gobwas/glob"
+	"github.com/stretchr/testify/assert"
+)
+
+var workspaceFS = fstest.MapFS{
+	"monorepo/pnpm-workspace.yaml":            {Data: []byte("packages:\n  - packages/*\n")},
+	"monorepo/package.json":                   {Data: []byte(`{"name": "monorepo", "private": true}`)},
+	"monorepo/.nvmrc":                         {Data: []byte("20\n")},
+	"monorepo/packages/ui/package.json":       {Data: []byte(`{"name": "ui"}`)},
+	"monorepo/packages/cli/package.json":      {Data: []byte(`{"name": "cli"}`)},
+	"monorepo/packages/cli/.nvmrc":            {Data: []byte("18\n")},
+	"standalone/package.json":                 {Data: []byte(`{"name": "standalone"}`)},
+	"standalone/examples/basic/package.json":  {Data: []byte(`{"name": "basic"}`)},
+	"standalone/examples/basic/tsconfig.json": {Data: []byte(`{}`)},
+}
+
+func TestAncestorFlagFiles(t *testing.T) {
+	options := fsOptionsForTesting("package.json")
+	options.AncestorFlagFiles = []glob.Glob{glob.MustCompile("pnpm-workspace.yaml")}
+	found, errs := LsHavingFS(workspaceFS, options, ".")
+	assert.Nil(t, errs)
+	assert.Equal(t, []string{"monorepo/packages/cli", "monorepo/packages/ui"}, found)
+
+	options.AncestorFlagFiles = []glob.Glob{glob.MustCompile("package.json")}
+	found, errs = LsHavingFS(workspaceFS, options, ".")
+	assert.Nil(t, errs)
+	assert.Equal(t, []string{"monorepo/packages/cli", "monorepo/packages/ui", "standalone/examples/basic"}, found)
+
+	found, errs = LsHavingFS(workspaceFS, options, "monorepo/packages/ui")
+	assert.Nil(t, errs)
+	assert.Equal(t, []string{}, found, "directories above the root directory are not ancestors")
+}
+
+func TestNearestAncestorMatcher(t *testing.T) {
+	options := fsOptionsForTesting("package.json")
+	options.Matcher = And(DefaultMatcher(options), NearestAncestorMatcher(
+		FlagFilesMatcher([]glob.Glob{glob.MustCompile("package.json")}, false),
+		CheckFileMatcher("package.json", regexp.MustCompile(`"private": true`), false),
+	))
+	found, errs := LsHavingFS(workspaceFS, options, ".")
+	assert.Nil(t, errs)
+	assert.Equal(t, []string{"monorepo/packages/cli", "monorepo/packages/ui"}, found)
+
+	options.Matcher = And(DefaultMatcher(options), AncestorMatcher(FlagFilesMatcher([]glob.Glob{glob.MustCompile("tsconfig.json")}, false)))
+	found, errs = LsHavingFS(workspaceFS, options, ".")
+	assert.Nil(t, errs)
+	assert.Equal(t, []string{}, found)
+}
+
+func TestCheckUpward(t *testing.T) {
+	options := fsOptionsForTesting("package.json")
+	options.Checks = []CheckClause{{File: ".nvmrc", Regexp: regexp.MustCompile(`^20`), Upward: true}}
+	options.FS = workspaceFS
+	found, errs := LsHavingResults(context.Background(), options, ".")
+	assert.Nil(t, errs)
+	assert.Equal(t, 2, len(found))
+	assert.Equal(t, "monorepo", found[0].Path)
+	assert.Equal(t, "monorepo/packages/ui", found[1].Path)
+	assert.Equal(t, []CheckResult{{File: "monorepo/.nvmrc", Outcome: CheckFileMatched}}, found[1].Checks)
+
+	options.Checks = []CheckClause{{Glob: glob.MustCompile(".nvm*"), Upward: true, Inverse: true}}
+	found, errs = LsHavingResults(context.Background(), options, ".")
+	assert.Nil(t, errs)
+	assert.Equal(t, 2, len(found))
+	assert.Equal(t, "standalone", found[0].Path)
+	assert.Equal(t, "standalone/examples/basic", found[1].Path)
+	assert.Nil(t, found[1].Checks)
+
+	options.Checks[0].Upward = false
+	found, errs = LsHavingResults(context.Background(), options, ".")
+	assert.Nil(t, errs)
+	assert.Equal(t, 3, len(found))
+}
+
+func TestCheckNearestAncestor(t *testing.T) {
+	options := fsOptionsForTesting("package.json")
+	options.Checks = []CheckClause{{File: "package.json", Regexp: regexp.MustCompile(`"private":\s*true`), NearestAncestor: true}}
+	options.FS = workspaceFS
+	found, errs := LsHavingResults(context.Background(), options, ".")
+	assert.Nil(t, errs)
+	assert.Equal(t, 2, len(found))
+	assert.Equal(t, "monorepo/packages/cli", found[0].Path)
+	assert.Equal(t, "monorepo/packages/ui", found[1].Path)
+	assert.Equal(t, []CheckResult{{File: "monorepo/package.json", Outcome: CheckFileMatched}}, found[1].Checks)
+
+	options.Checks[0].Inverse = true
+	paths, errs := LsHavingFS(workspaceFS, options, ".")
+	assert.Nil(t, errs)
+	assert.Equal(t, []string{"monorepo", "standalone", "standalone/examples/basic"}, paths, "directories without such ancestor pass inverse checking")
+}
@@ -0,0 +1,69 @@
+package lsh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+// Matcher requiring the command to exit with code 0 when it is run in the directory.
+//
+// The command is run by "sh -c" (or "cmd /C" on Windows) with the directory as the working directory,
+// and its output is discarded.
+// Exiting with a non-zero code means the directory does not match,
+// while failing to run the command or timing out is an error of type *PathError.
+// Zero timeout means no limit on how long the command can run.
+// At most concurrency (if it is greater than zero) commands are run at the same time.
+// It works only with the file system of the operating system.
+func CommandMatcher(command string, timeout time.Duration, concurrency int) Matcher {
+	var slots chan emptyStruct
+	if concurrency > 0 {
+		slots = make(chan emptyStruct, concurrency)
+	}
+	return MatcherFunc(func(dir *Candidate) (bool, error) {
+		if _, ok := dir.fsys.(osFileSystem); !ok {
+			return false, &PathError{PhaseRunCheckCommand, dir.Path, errors.New("check command can only be run in directories of the file system of the operating system")}
+		}
+		if slots != nil {
+			select {
+			case slots <- emptyVar:
+				defer func() { <-slots }()
+			case <-dir.ctx.Done():
+				return false, dir.ctx.Err()
+			}
+		}
+		ctx := dir.ctx
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		cmd := shellCommand(ctx, command)
+		cmd.Dir = dir.Path
+		cmd.WaitDelay = time.Second // in case processes started by the command keep running after it is killed
+		err := cmd.Run()
+		var exitError *exec.ExitError
+		switch {
+		case err == nil:
+			return true, nil
+		case dir.ctx.Err() != nil:
+			return false, dir.ctx.Err()
+		case ctx.Err() != nil:
+			return false, &PathError{PhaseRunCheckCommand, dir.Path, fmt.Errorf("run %q in %s: timed out after %s", command, dir.Path, timeout)}
+		case errors.As(err, &exitError):
+			return false, nil
+		default:
+			return false, &PathError{PhaseRunCheckCommand, dir.Path, fmt.Errorf("run %q in %s: %w", command, dir.Path, err)}
+		}
+	})
+}
+
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
@@ -0,0 +1,69 @@
+package lsh
+
+import (
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("commands in this test need a POSIX shell")
+	}
+	options := optionsForTesting("package.json")
+	options.CheckCommand = "grep -q dependencies package.json"
+	found, errs := LsHaving(options, repo1)
+	assert.Nil(t, errs)
+	assert.Equal(t, []string{repo1 + "/inbound"}, found)
+
+	options.CheckCommand = "exit 1"
+	found, errs = LsHaving(options, repo1)
+	assert.Nil(t, errs)
+	assert.Equal(t, []string{}, found)
+}
+
+func TestCheckCommandTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("commands in this test need a POSIX shell")
+	}
+	options := optionsForTesting("serverless.yml")
+	options.Depth = 1
+	options.CheckCommand = "sleep 5"
+	options.CheckCommandTimeout = 100 * time.Millisecond
+	start := time.Now()
+	found, errs := LsHaving(options, repo1)
+	assert.Less(t, time.Since(start), 3*time.Second)
+	assert.Equal(t, []string{}, found)
+	assert.Equal(t, 1, len(errs))
+	var pathError *PathError
+	assert.True(t, errors.As(errs[0], &pathError))
+	assert.Equal(t, PhaseRunCheckCommand, pathError.Phase)
+	assert.Equal(t, repo1+"/inbound", pathError.Path)
+	assert.EqualError(t, errs[0], `run "sleep 5" in `+repo1+"/inbound: timed out after 100ms")
+}
+
+func TestCheckCommandConcurrency(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("commands in this test need a POSIX shell")
+	}
+	options := optionsForTesting("package.json")
+	options.Concurrency = 4
+	lock := filepath.Join(t.TempDir(), "lock")
+	options.CheckCommand = "mkdir " + lock + " && sleep 0.3 && rmdir " + lock // fails if another one is running at the same time
+	options.CheckCommandConcurrency = 1
+	found, errs := LsHaving(options, repo1)
+	assert.Nil(t, errs)
+	assert.Equal(t, 5, len(found))
+}
+
+func TestCheckCommandFS(t *testing.T) {
+	options := fsOptionsForTesting("package.json")
+	options.CheckCommand = "exit 0"
+	found, errs := LsHavingFS(mapFS, options, ".")
+	assert.Equal(t, []string{}, found)
+	assert.Equal(t, 3, len(errs))
+}
@@ -0,0 +1,308 @@
+package lsh
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A dependency declared in a file in the directory
+type Dependency struct {
+	// Path of the file declaring the dependency
+	File string
+
+	// Name of the dependency, such like "aws-sdk", "github.com/gobwas/glob" or "com.amazonaws:aws-java-sdk-s3"
+	Name string
+
+	// Version (or version range) of the dependency as declared, such like "^2.1.0", "v0.2.3" or "1.12.0".
+	// It could be empty.
+	Version string
+}
+
+// Constraint on the version of a dependency, such like "aws-sdk<3" or "github.com/gobwas/glob>=0.2,<1"
+type DependencyConstraint struct {
+	// The expression that the constraint is parsed from
+	Expression string
+
+	// Name of the dependency
+	Name string
+
+	comparators []versionComparator
+}
+
+// A comparison with a version, such like ">=1.2"
+type versionComparator struct {
+	operator string
+	version  semanticVersion
+}
+
+// Parse an expression into a DependencyConstraint.
+//
+// The expression is a dependency name optionally followed by comparators separated by ",".
+// A comparator is an operator (<, <=, >, >=, == or !=) followed by a version, such like "<3" or ">=1.2.0".
+// Without comparators, the constraint is satisfied as long as the dependency is declared.
+// Versions are compared as semantic versions, missing minor and patch numbers are regarded as 0.
+func ParseDependencyConstraint(expression string) (*DependencyConstraint, error) {
+	c := &DependencyConstraint{Expression: expression}
+	rest := strings.TrimSpace(expression)
+	end := strings.IndexAny(rest, "<>=!")
+	if end < 0 {
+		end = len(rest)
+	}
+	c.Name = strings.TrimSpace(rest[:end])
+	if c.Name == "" {
+		return nil, fmt.Errorf("invalid dependency constraint %q: missing dependency name", expression)
+	}
+	if end == len(rest) {
+		return c, nil
+	}
+	for _, comparatorString := range strings.Split(rest[end:], ",") {
+		comparatorString = strings.TrimSpace(comparatorString)
+		var comparator versionComparator
+		for _, operator := range []string{"<=", ">=", "==", "!=", "<", ">"} {
+			if strings.HasPrefix(comparatorString, operator) {
+				comparator.operator = operator
+				break
+			}
+		}
+		if comparator.operator == "" {
+			return nil, fmt.Errorf("invalid dependency constraint %q: expecting <, <=, >, >=, == or != but found %q", expression, comparatorString)
+		}
+		version, ok := parseSemanticVersion(strings.TrimSpace(comparatorString[len(comparator.operator):]))
+		if !ok {
+			return nil, fmt.Errorf("invalid dependency constraint %q: invalid version in %q", expression, comparatorString)
+		}
+		comparator.version = version
+		c.comparators = append(c.comparators, comparator)
+	}
+	return c, nil
+}
+
+// Check whether the version declared satisfies the constraint.
+// For version ranges (such like "^2.1.0" or ">=2.1.0 <3"), the first version in it is used.
+func (c *DependencyConstraint) SatisfiedBy(version string) bool {
+	if len(c.comparators) == 0 {
+		return true
+	}
+	v, ok := parseSemanticVersion(firstVersion.FindString(version))
+	if !ok {
+		return false
+	}
+	for _, comparator := range c.comparators {
+		result := v.compare(comparator.version)
+		var satisfied bool
+		switch comparator.operator {
+		case "<":
+			satisfied = result < 0
+		case "<=":
+			satisfied = result <= 0
+		case ">":
+			satisfied = result > 0
+		case ">=":
+			satisfied = result >= 0
+		case "==":
+			satisfied = result == 0
+		case "!=":
+			satisfied = result != 0
+		}
+		if !satisfied {
+			return false
+		}
+	}
+	return true
+}
+
+var firstVersion = regexp.MustCompile(`[0-9]+(\.[0-9]+)*(-[0-9A-Za-z.-]+)?`)
+
+// Matcher requiring each of the constraints to be satisfied by a dependency declared in
+// package.json (dependencies and devDependencies), go.mod (require directives)
+// or build.gradle/build.gradle.kts (coordinates such like "group:name:version") in the directory.
+// The dependencies satisfying the constraints are recorded in Result.Dependencies.
+func DependsOnMatcher(constraints []*DependencyConstraint) Matcher {
+	return MatcherFunc(func(dir *Candidate) (bool, error) {
+		dependencies, err := readDependencies(dir)
+		if err != nil {
+			return false, err
+		}
+		var satisfying []Dependency
+		for _, constraint := range constraints {
+			satisfied := false
+			for _, dependency := range dependencies {
+				if dependency.Name == constraint.Name && constraint.SatisfiedBy(dependency.Version) {
+					satisfying = append(satisfying, dependency)
+					satisfied = true
+				}
+			}
+			if !satisfied {
+				return false, nil
+			}
+		}
+		dir.Result.Dependencies = append(dir.Result.Dependencies, satisfying...)
+		return true, nil
+	})
+}
+
+// Read dependencies declared in the files in the directory
+func readDependencies(dir *Candidate) ([]Dependency, error) {
+	var dependencies []Dependency
+	for _, entry := range dir.Entries {
+		var parse func(content []byte) ([][2]string, error)
+		switch entry.Name() {
+		case "package.json":
+			parse = parsePackageJSONDependencies
+		case "go.mod":
+			parse = parseGoModDependencies
+		case "build.gradle", "build.gradle.kts":
+			parse = parseGradleDependencies
+		default:
+			continue
+		}
+		if entry.IsDir() {
+			continue
+		}
+		file := dir.Join(entry.Name())
+		content, err := dir.ReadFile(entry.Name())
+		if err != nil {
+			return nil, &PathError{PhaseReadCheckFile, file, err}
+		}
+		declared, err := parse(content)
+		if err != nil {
+			return nil, &PathError{PhaseParseCheckFile, file, fmt.Errorf("parse %s: %w", file, err)}
+		}
+		for _, nameAndVersion := range declared {
+			dependencies = append(dependencies, Dependency{file, nameAndVersion[0], nameAndVersion[1]})
+		}
+	}
+	return dependencies, nil
+}
+
+func parsePackageJSONDependencies(content []byte) ([][2]string, error) {
+	if len(bytes.TrimSpace(content)) == 0 {
+		return nil, nil
+	}
+	var packageJSON struct {
+		Dependencies    map[string]string `json:"dependencies"`
+		DevDependencies map[string]string `json:"devDependencies"`
+	}
+	if err := json.Unmarshal(content, &packageJSON); err != nil {
+		return nil, err
+	}
+	var declared [][2]string
+	for _, dependencies := range []map[string]string{packageJSON.Dependencies, packageJSON.DevDependencies} {
+		start := len(declared)
+		for name, version := range dependencies {
+			declared = append(declared, [2]string{name, version})
+		}
+		sort.Slice(declared[start:], func(i, j int) bool { return declared[start+i][0] < declared[start+j][0] })
+	}
+	return declared, nil
+}
+
+func parseGoModDependencies(content []byte) ([][2]string, error) {
+	var declared [][2]string
+	inRequireBlock := false
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "//")
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+			continue
+		case inRequireBlock && fields[0] == ")":
+			inRequireBlock = false
+		case len(fields) == 2 && fields[0] == "require" && fields[1] == "(":
+			inRequireBlock = true
+		case len(fields) == 3 && fields[0] == "require":
+			declared = append(declared, [2]string{fields[1], fields[2]})
+		case inRequireBlock && len(fields) == 2:
+			declared = append(declared, [2]string{fields[0], fields[1]})
+		}
+	}
+	return declared, scanner.Err()
+}
+
+var gradleCoordinates = regexp.MustCompile(`['"]([\w.-]+):([\w.-]+)(?::([^'":@]+))?(?::[\w.-]+)?(?:@[\w]+)?['"]`)
+var gradleMapNotation = regexp.MustCompile(`group\s*[:=]\s*['"]([\w.-]+)['"]\s*,\s*name\s*[:=]\s*['"]([\w.-]+)['"](?:\s*,\s*version\s*[:=]\s*['"]([^'"]+)['"])?`)
+
+func parseGradleDependencies(content []byte) ([][2]string, error) {
+	var declared [][2]string
+	for _, re := range []*regexp.Regexp{gradleCoordinates, gradleMapNotation} {
+		for _, match := range re.FindAllSubmatch(content, -1) {
+			declared = append(declared, [2]string{string(match[1]) + ":" + string(match[2]), string(match[3])})
+		}
+	}
+	return declared, nil
+}
+
+// Semantic version such like 1.2.3-beta.1, build metadata is ignored
+type semanticVersion struct {
+	numbers    []int
+	prerelease []string
+}
+
+func parseSemanticVersion(s string) (semanticVersion, bool) {
+	s = strings.TrimPrefix(s, "v")
+	s, _, _ = strings.Cut(s, "+")
+	var v semanticVersion
+	s, prerelease, hasPrerelease := strings.Cut(s, "-")
+	if hasPrerelease {
+		v.prerelease = strings.Split(prerelease, ".")
+	}
+	for _, number := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(number)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		v.numbers = append(v.numbers, n)
+	}
+	return v, true
+}
+
+// Compare with another version, returning -1, 0 or 1
+func (v semanticVersion) compare(other semanticVersion) int {
+	for i := 0; i < max(len(v.numbers), len(other.numbers)); i++ {
+		a, b := 0, 0
+		if i < len(v.numbers) {
+			a = v.numbers[i]
+		}
+		if i < len(other.numbers) {
+			b = other.numbers[i]
+		}
+		if a != b {
+			return cmp.Compare(a, b)
+		}
+	}
+	switch {
+	case len(v.prerelease) == 0 && len(other.prerelease) == 0:
+		return 0
+	case len(v.prerelease) == 0: // release is greater than prerelease
+		return 1
+	case len(other.prerelease) == 0:
+		return -1
+	}
+	for i := 0; i < min(len(v.prerelease), len(other.prerelease)); i++ {
+		a, b := v.prerelease[i], other.prerelease[i]
+		if a == b {
+			continue
+		}
+		aNumber, aErr := strconv.Atoi(a)
+		bNumber, bErr := strconv.Atoi(b)
+		switch {
+		case aErr == nil && bErr == nil:
+			return cmp.Compare(aNumber, bNumber)
+		case aErr == nil: // numeric identifiers are lower than alphanumeric ones
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			return strings.Compare(a, b)
+		}
+	}
+	return cmp.Compare(len(v.prerelease), len(other.prerelease))
+}
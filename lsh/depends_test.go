@@ -0,0 +1,108 @@
+package lsh
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var dependenciesFS = fstest.MapFS{
+	"node/package.json": {Data: []byte(`{"dependencies": {"aws-sdk": "^2.1354.0", "lodash": "4.17.21"}, "devDependencies": {"mocha": "~10.2.0"}}`)},
+	"go/go.mod": {Data: []byte(`module example.com/go
+
+go 1.21
+
+require github.com/gobwas/glob v0.2.3
+
+require (
+	github.com/stretchr/testify v1.8.4
+	golang.org/x/exp v0.0.0-20230713183714-613f0c0eb8a1 // indirect
+)
+`)},
+	"java/build.gradle": {Data: []byte(`dependencies {
+    implementation 'com.amazonaws:aws-java-sdk-s3:1.12.261'
+    implementation group: 'org.apache.logging.log4j', name: 'log4j-core', version: '2.14.1'
+    testImplementation "junit:junit:4.13.2@jar"
+}`)},
+	"invalid/package.json": {Data: []byte(`{"dependencies": `)},
+}
+
+func TestDependsOn(t *testing.T) {
+	for _, tc := range []struct {
+		constraints []string
+		expected    []string
+	}{
+		{[]string{"aws-sdk"}, []string{"node"}},
+		{[]string{"aws-sdk<3"}, []string{"node"}},
+		{[]string{"aws-sdk>=3"}, []string{}},
+		{[]string{"mocha>=10,<11", "lodash==4.17.21"}, []string{"node"}},
+		{[]string{"mocha>=10", "lodash!=4.17.21"}, []string{}},
+		{[]string{"github.com/gobwas/glob>=0.2"}, []string{"go"}},
+		{[]string{"golang.org/x/exp<0.0.1"}, []string{"go"}},
+		{[]string{"github.com/stretchr/testify>1.8.4"}, []string{}},
+		{[]string{"com.amazonaws:aws-java-sdk-s3<1.12.300"}, []string{"java"}},
+		{[]string{"org.apache.logging.log4j:log4j-core<2.17"}, []string{"java"}},
+		{[]string{"junit:junit==4.13.2"}, []string{"java"}},
+	} {
+		options := fsOptionsForTesting()
+		for _, expression := range tc.constraints {
+			constraint, err := ParseDependencyConstraint(expression)
+			assert.Nil(t, err)
+			options.DependsOn = append(options.DependsOn, constraint)
+		}
+		found, errs := LsHavingFS(dependenciesFS, options, ".")
+		assert.Equal(t, tc.expected, found, tc.constraints)
+		assert.Equal(t, 1, len(errs), tc.constraints) // invalid/package.json can't be parsed
+	}
+}
+
+func TestDependsOnResult(t *testing.T) {
+	constraint, _ := ParseDependencyConstraint("mocha")
+	options := fsOptionsForTesting("package.json")
+	options.DependsOn = []*DependencyConstraint{constraint}
+	options.FS = dependenciesFS
+	found, errs := LsHavingResults(context.Background(), options, "node")
+	assert.Nil(t, errs)
+	assert.Equal(t, 1, len(found))
+	assert.Equal(t, []Dependency{{"node/package.json", "mocha", "~10.2.0"}}, found[0].Dependencies)
+}
+
+func TestSemanticVersionCompare(t *testing.T) {
+	for _, tc := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"1.2", "1.2.0", 0},
+		{"v1.2.3", "1.2.3", 0},
+		{"1.2.3+build.1", "1.2.3", 0},
+		{"1.10.0", "1.9.0", 1},
+		{"2", "10", -1},
+		{"1.0.0-alpha", "1.0.0", -1},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"1.0.0-beta.11", "1.0.0-beta.2", 1},
+		{"1.0.0-rc.1", "1.0.0-beta.11", 1},
+	} {
+		a, _ := parseSemanticVersion(tc.a)
+		b, _ := parseSemanticVersion(tc.b)
+		assert.Equal(t, tc.expected, a.compare(b), tc.a+" vs "+tc.b)
+	}
+}
+
+func TestParseDependencyConstraintError(t *testing.T) {
+	for _, tc := range []struct {
+		expression string
+		err        string
+	}{
+		{`<3`, `invalid dependency constraint "<3": missing dependency name`},
+		{`aws-sdk=3`, `invalid dependency constraint "aws-sdk=3": expecting <, <=, >, >=, == or != but found "=3"`},
+		{`aws-sdk<3,`, `invalid dependency constraint "aws-sdk<3,": expecting <, <=, >, >=, == or != but found ""`},
+		{`aws-sdk<3.x`, `invalid dependency constraint "aws-sdk<3.x": invalid version in "<3.x"`},
+	} {
+		_, err := ParseDependencyConstraint(tc.expression)
+		assert.EqualError(t, err, tc.err)
+	}
+}
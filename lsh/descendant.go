@@ -0,0 +1,60 @@
+package lsh
+
+import (
+	"io/fs"
+
+	"github.com/gobwas/glob"
+)
+
+// Matcher requiring each of the globs to match the name of at least one entry below the directory.
+// Entries in the directory have depth 1, entries in its subdirectories have depth 2, and so on.
+// Entries deeper than maxDepth are not looked at, zero or negative maxDepth means no limit.
+// Subdirectories excluded by Options.Excludes are skipped, and symbolic links are not followed.
+func DescendantMatcher(globs []glob.Glob, maxDepth int) Matcher {
+	return MatcherFunc(func(dir *Candidate) (bool, error) {
+		found := make([]bool, len(globs))
+		remaining := len(globs)
+		var walk func(subDir string, entries []fs.DirEntry, depth int) error
+		walk = func(subDir string, entries []fs.DirEntry, depth int) error {
+			for _, entry := range entries {
+				path := dir.fsys.Join(subDir, entry.Name())
+				if entry.IsDir() && len(dir.excludes) > 0 && anyGlobMatch(dir.excludes, dir.Join(path)) {
+					continue
+				}
+				for i := range allMatchingGlobs(globs, entry.Name()) {
+					if !found[i] {
+						found[i] = true
+						remaining--
+					}
+				}
+				if remaining == 0 {
+					return nil
+				}
+			}
+			if maxDepth > 0 && depth >= maxDepth {
+				return nil
+			}
+			for _, entry := range entries {
+				if remaining == 0 || dir.ctx.Err() != nil {
+					return nil
+				}
+				path := dir.fsys.Join(subDir, entry.Name())
+				if !entry.IsDir() || len(dir.excludes) > 0 && anyGlobMatch(dir.excludes, dir.Join(path)) {
+					continue
+				}
+				subEntries, err := dir.fsys.ReadDir(dir.Join(path))
+				if err != nil {
+					return &PathError{PhaseReadDir, dir.Join(path), err}
+				}
+				if err := walk(path, subEntries, depth+1); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if err := walk("", dir.Entries, 1); err != nil {
+			return false, err
+		}
+		return remaining == 0, nil
+	})
+}
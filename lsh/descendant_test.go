@@ -0,0 +1,48 @@
+package lsh
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/gobwas/glob"
+	"github.com/stretchr/testify/assert"
+)
+
+var testsFS = fstest.MapFS{
+	"web/package.json":                         {Data: []byte(`{"name": "web"}`)},
+	"web/src/app.ts":                           {Data: []byte("export {}\n")},
+	"web/src/components/button/button.test.ts": {Data: []byte("test()\n")},
+	"api/package.json":                         {Data: []byte(`{"name": "api"}`)},
+	"api/src/index.ts":                         {Data: []byte("export {}\n")},
+	"api/node_modules/lib/lib.test.ts":         {Data: []byte("test()\n")},
+	"service/build.gradle":                     {Data: []byte("apply plugin: 'java'\n")},
+	"service/src/test/java/ServiceTest.java":   {Data: []byte("class ServiceTest {}\n")},
+	"service/src/it/java/ServiceIT.java":       {Data: []byte("class ServiceIT {}\n")},
+}
+
+func TestDescendantFlagFiles(t *testing.T) {
+	for _, tc := range []struct {
+		flagFile    string
+		descendants []string
+		depth       int
+		expected    []string
+	}{
+		{"package.json", []string{"*.test.ts"}, 0, []string{"web"}},
+		{"package.json", []string{"*.test.ts"}, 4, []string{"web"}},
+		{"package.json", []string{"*.test.ts"}, 3, []string{}},
+		{"package.json", []string{"*.ts"}, 2, []string{"api", "web"}},
+		{"package.json", []string{"package.json"}, 1, []string{"api", "web"}},
+		{"build.gradle", []string{"*IT.java", "*Test.java"}, 0, []string{"service"}},
+		{"build.gradle", []string{"*IT.java", "*.ts"}, 0, []string{}},
+		{"*", []string{"*IT.java"}, -1, []string{".", "service", "service/src", "service/src/it", "service/src/it/java"}},
+	} {
+		options := fsOptionsForTesting(tc.flagFile)
+		for _, descendant := range tc.descendants {
+			options.DescendantFlagFiles = append(options.DescendantFlagFiles, glob.MustCompile(descendant, '/'))
+		}
+		options.DescendantDepth = tc.depth
+		found, errs := LsHavingFS(testsFS, options, ".")
+		assert.Nil(t, errs)
+		assert.Equal(t, tc.expected, found, tc)
+	}
+}
@@ -0,0 +1,63 @@
+package lsh
+
+// The phase in which an error happened
+type Phase int
+
+const (
+	// Getting information of the root directory
+	PhaseRootStat Phase = iota + 1
+
+	// Reading entries in a directory
+	PhaseReadDir
+
+	// Getting information of, or reading the content of, a check file
+	PhaseReadCheckFile
+
+	// Parsing the content of a check file for evaluating predicates, or a file declaring dependencies
+	PhaseParseCheckFile
+
+	// Running the check command in a directory
+	PhaseRunCheckCommand
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseRootStat:
+		return "root stat"
+	case PhaseReadDir:
+		return "read dir"
+	case PhaseReadCheckFile:
+		return "check-file read"
+	case PhaseParseCheckFile:
+		return "check-file parse"
+	case PhaseRunCheckCommand:
+		return "check-command run"
+	default:
+		return "unknown"
+	}
+}
+
+// Error happened when accessing a path.
+//
+// The underlying error can be checked with errors.Is and errors.As,
+// for example errors.Is(err, fs.ErrPermission) or errors.Is(err, fs.ErrNotExist).
+type PathError struct {
+	// In which phase the error happened
+	Phase Phase
+
+	// The path of the directory or file being accessed
+	Path string
+
+	// The underlying error, usually an *fs.PathError
+	Err error
+}
+
+// The message of the underlying error is returned,
+// because it normally contains the operation and the path already.
+func (e *PathError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,87 @@
+package lsh
+
+import (
+	"io/fs"
+	"time"
+)
+
+// Predicate deciding whether an entry in the directory can be regarded as a flag file
+type EntryFilter func(entry fs.DirEntry) (bool, error)
+
+// Types of entries in directories, they can be combined with "|", such like EntryTypeFile|EntryTypeSymlink
+type EntryType int
+
+const (
+	// Regular file
+	EntryTypeFile EntryType = 1 << iota
+
+	// Directory
+	EntryTypeDir
+
+	// Symbolic link, what it links to does not matter
+	EntryTypeSymlink
+)
+
+// Filter accepting entries of any of the types
+func EntryTypeFilter(types EntryType) EntryFilter {
+	return func(entry fs.DirEntry) (bool, error) {
+		mode := entry.Type()
+		return types&EntryTypeFile != 0 && mode.IsRegular() ||
+			types&EntryTypeDir != 0 && mode.IsDir() ||
+			types&EntryTypeSymlink != 0 && mode&fs.ModeSymlink != 0, nil
+	}
+}
+
+// Filter accepting entries modified after the time (if it is not zero) and before the time (if it is not zero)
+func ModTimeFilter(after, before time.Time) EntryFilter {
+	return func(entry fs.DirEntry) (bool, error) {
+		info, err := entry.Info()
+		if err != nil {
+			return false, err
+		}
+		modTime := info.ModTime()
+		return (after.IsZero() || modTime.After(after)) && (before.IsZero() || modTime.Before(before)), nil
+	}
+}
+
+// Filter accepting entries having size between min and max (both inclusive, negative max means no limit).
+// Directories are always accepted, because their sizes mean different things in different file systems.
+func SizeFilter(min, max int64) EntryFilter {
+	return func(entry fs.DirEntry) (bool, error) {
+		if entry.IsDir() {
+			return true, nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return false, err
+		}
+		size := info.Size()
+		return size >= min && (max < 0 || size <= max), nil
+	}
+}
+
+// Filter accepting entries executable (by anyone) if executable is true, or those not executable if it is false.
+// Symbolic links are not followed.
+func ExecutableFilter(executable bool) EntryFilter {
+	return func(entry fs.DirEntry) (bool, error) {
+		info, err := entry.Info()
+		if err != nil {
+			return false, err
+		}
+		return (info.Mode().Perm()&0111 != 0) == executable, nil
+	}
+}
+
+// Check whether the entry (at the path relative to the directory) is accepted by all of the filters
+func acceptedByFilters(dir *Candidate, path string, entry fs.DirEntry, filters []EntryFilter) (bool, error) {
+	for _, filter := range filters {
+		accepted, err := filter(entry)
+		if err != nil {
+			return false, &PathError{PhaseReadDir, dir.Join(path), err}
+		}
+		if !accepted {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,43 @@
+package lsh
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var oldTime = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+var newTime = time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)
+
+var metadataFS = fstest.MapFS{
+	"old/gradlew":           {Data: []byte("#!/bin/sh\n"), Mode: 0755, ModTime: oldTime},
+	"old/package-lock.json": {Data: []byte("{}\n"), Mode: 0644, ModTime: oldTime},
+	"new/gradlew":           {Data: []byte("#!/bin/sh\nexec java\n"), Mode: 0644, ModTime: newTime},
+	"new/package-lock.json": {Data: []byte(""), Mode: 0644, ModTime: newTime},
+}
+
+func TestFlagFileFilters(t *testing.T) {
+	for _, tc := range []struct {
+		flagFile string
+		filters  []EntryFilter
+		expected []string
+	}{
+		{"gradlew", []EntryFilter{ExecutableFilter(true)}, []string{"old"}},
+		{"gradlew", []EntryFilter{ExecutableFilter(false)}, []string{"new"}},
+		{"package-lock.json", []EntryFilter{ModTimeFilter(time.Time{}, oldTime.AddDate(0, 6, 0))}, []string{"old"}},
+		{"package-lock.json", []EntryFilter{ModTimeFilter(oldTime, time.Time{})}, []string{"new"}},
+		{"package-lock.json", []EntryFilter{ModTimeFilter(oldTime.AddDate(0, 0, -1), newTime.AddDate(0, 0, 1))}, []string{"new", "old"}},
+		{"package-lock.json", []EntryFilter{SizeFilter(1, -1)}, []string{"old"}},
+		{"gradlew", []EntryFilter{SizeFilter(0, 10)}, []string{"old"}},
+		{"gradlew", []EntryFilter{SizeFilter(11, 100), ExecutableFilter(true)}, []string{}},
+		{"*", []EntryFilter{SizeFilter(20, -1)}, []string{".", "new"}}, // directories are always accepted
+	} {
+		options := fsOptionsForTesting(tc.flagFile)
+		options.FlagFileFilters = tc.filters
+		found, errs := LsHavingFS(metadataFS, options, ".")
+		assert.Nil(t, errs)
+		assert.Equal(t, tc.expected, found, tc.flagFile)
+	}
+}
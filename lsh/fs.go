@@ -0,0 +1,94 @@
+package lsh
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// The file system that directories are looked into
+type fileSystem interface {
+	Stat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	ReadFile(name string) ([]byte, error)
+	Join(elem ...string) string
+	Base(name string) string
+	Key(name string) string
+}
+
+// Choose the file system according to the options
+func newFileSystem(options *Options) fileSystem {
+	if options.FS == nil {
+		return osFileSystem{}
+	}
+	return ioFileSystem{options.FS}
+}
+
+// The file system of the operating system, paths are separated by filepath.Separator
+type osFileSystem struct{}
+
+func (osFileSystem) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFileSystem) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (osFileSystem) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (osFileSystem) Join(elem ...string) string {
+	return filepath.Join(elem...)
+}
+
+// The last element of the path, paths like "." and ".." are resolved to absolute paths first
+func (osFileSystem) Base(name string) string {
+	if base := filepath.Base(name); base != "." && base != ".." {
+		return base
+	}
+	if abs, err := filepath.Abs(name); err == nil {
+		return filepath.Base(abs)
+	}
+	return filepath.Base(name)
+}
+
+// Key identifying the path, so that relative and absolute forms of the same path have the same key.
+// It is the absolute path, or the cleaned path if it can't be made absolute.
+func (osFileSystem) Key(name string) string {
+	if abs, err := filepath.Abs(name); err == nil {
+		return abs
+	}
+	return filepath.Clean(name)
+}
+
+// An fs.FS, paths are always separated by '/'
+type ioFileSystem struct {
+	fsys fs.FS
+}
+
+func (f ioFileSystem) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(f.fsys, name)
+}
+
+func (f ioFileSystem) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(f.fsys, name)
+}
+
+func (f ioFileSystem) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(f.fsys, name)
+}
+
+func (ioFileSystem) Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+func (ioFileSystem) Base(name string) string {
+	return path.Base(name)
+}
+
+func (ioFileSystem) Key(name string) string {
+	return path.Clean(name)
+}
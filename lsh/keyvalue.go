@@ -0,0 +1,197 @@
+package lsh
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Condition on the value of a key in a line-oriented key/value file,
+// such like .properties, .env, .npmrc and INI (.ini, .cfg) files.
+type KeyPredicate struct {
+	// The expression that the predicate is parsed from
+	Expression string
+
+	section    string
+	key        string
+	comparison valueComparison
+}
+
+// Parse an expression into a KeyPredicate.
+//
+// The expression is a key optionally followed by an operator and a value:
+//
+//	org.gradle.jvmargs                 the key exists (its value could be empty)
+//	org.gradle.caching == true         the value equals to the value specified
+//	org.gradle.caching != true         the key exists, and its value does not equal to the value specified
+//	org.gradle.jvmargs =~ Xmx[0-9]+g   the value matches the regular expression
+//	org.gradle.jvmargs !~ Xmx[0-9]+g   the key exists, and its value does not match the regular expression
+//	[flake8]max-line-length == 120     the key is in the section
+//
+// Keys without sections match only those not in any section.
+// Keys and section names are case sensitive.
+// The value could be quoted with double quotes, otherwise spaces around it are trimmed.
+func ParseKeyPredicate(expression string) (*KeyPredicate, error) {
+	p := &KeyPredicate{Expression: expression}
+	rest := strings.TrimSpace(expression)
+	if strings.HasPrefix(rest, "[") {
+		end := strings.IndexByte(rest, ']')
+		if end < 0 {
+			return nil, fmt.Errorf("invalid key expression %q: missing \"]\"", expression)
+		}
+		p.section = strings.TrimSpace(rest[1:end])
+		rest = rest[end+1:]
+	}
+	end := strings.IndexFunc(rest, func(r rune) bool { return r == ' ' || r == '=' || r == '!' })
+	if end < 0 {
+		end = len(rest)
+	}
+	p.key = rest[:end]
+	if p.key == "" {
+		return nil, fmt.Errorf("invalid key expression %q: missing key", expression)
+	}
+	comparison, err := parseValueComparison(rest[end:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid key expression %q: %w", expression, err)
+	}
+	p.comparison = comparison
+	return p, nil
+}
+
+func (p *KeyPredicate) Test(file string, content []byte) (bool, error) {
+	value, found := parseKeyValues(file, content)[[2]string{p.section, p.key}]
+	return found && p.comparison.test(value), nil
+}
+
+// Parse the content as key/value pairs keyed by section and key.
+//
+// Lines starting with "#", ";" or "!" are comments, and "[name]" starts a section.
+// For INI files (.ini and .cfg), keys and values are separated by the first "=" or ":",
+// and lines indented continue the values in previous lines.
+// For .properties files, keys and values are separated by the first "=", ":" or spaces not escaped.
+// For other files (such like .env and .npmrc), keys and values are separated by the first "=" not escaped,
+// so that keys like "//registry.npmjs.org/:_authToken" are kept intact.
+// For files other than INI files, "\" at the end of a line continues the value in the next line,
+// escape sequences such like "\t" and "\u0041" are unescaped (as in .properties files),
+// values quoted are unquoted and "export " before keys is ignored (as in .env files).
+// If a key appears more than once in a section, the last value is used.
+func parseKeyValues(file string, content []byte) map[[2]string]string {
+	ini := false
+	separators := "="
+	switch strings.ToLower(path.Ext(file)) {
+	case ".ini", ".cfg":
+		ini = true
+		separators = "=:"
+	case ".properties":
+		separators = "=: \t"
+	}
+	result := make(map[[2]string]string)
+	section := ""
+	var lastKey [2]string // for continuation lines of INI files
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, len(content)+1)
+	for scanner.Scan() {
+		rawLine := scanner.Text()
+		line := strings.TrimSpace(rawLine)
+		if ini && line != "" && rawLine[0] != line[0] && lastKey[1] != "" && strings.IndexByte("#;", line[0]) < 0 {
+			// continuation of the value of the last key
+			result[lastKey] = strings.TrimSpace(result[lastKey] + "\n" + line)
+			continue
+		}
+		lastKey = [2]string{}
+		if line == "" || strings.IndexByte("#;!", line[0]) >= 0 {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if !ini {
+			for strings.HasSuffix(line, `\`) && !strings.HasSuffix(line, `\\`) && scanner.Scan() {
+				line = line[:len(line)-1] + strings.TrimSpace(scanner.Text())
+			}
+		}
+		if !ini {
+			line = strings.TrimPrefix(line, "export ")
+		}
+		key, value := splitKeyValue(line, separators, !ini)
+		if !ini {
+			key = unescapeProperty(key)
+			value = unquoteValue(value)
+		}
+		lastKey = [2]string{section, key}
+		result[lastKey] = value
+	}
+	return result
+}
+
+// Split the line at the first of the separators, which could be escaped by "\" if escaped is true
+func splitKeyValue(line string, separators string, escaped bool) (key, value string) {
+	for i := 0; i < len(line); i++ {
+		if escaped && line[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.IndexByte(separators, line[i]) < 0 {
+			continue
+		}
+		value = strings.TrimSpace(line[i+1:])
+		if (line[i] == ' ' || line[i] == '\t') && value != "" && (value[0] == '=' || value[0] == ':') {
+			value = strings.TrimSpace(value[1:]) // such like "key = value"
+		}
+		return strings.TrimSpace(line[:i]), value
+	}
+	return line, ""
+}
+
+// Remove quotes around the value, or unescape escape sequences if it is not quoted
+func unquoteValue(value string) string {
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		return value[1 : len(value)-1]
+	}
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			return unquoted
+		}
+		return value[1 : len(value)-1]
+	}
+	return unescapeProperty(value)
+}
+
+// Unescape escape sequences as in .properties files
+func unescapeProperty(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			if code, err := strconv.ParseUint(s[i+1:min(i+5, len(s))], 16, 16); err == nil && i+5 <= len(s) {
+				b.WriteRune(rune(code))
+				i += 4
+			} else {
+				b.WriteByte('u')
+			}
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
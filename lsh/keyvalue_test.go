@@ -0,0 +1,95 @@
+package lsh
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/gobwas/glob"
+	"github.com/stretchr/testify/assert"
+)
+
+var keyValueFS = fstest.MapFS{
+	"gradle/gradle.properties": {Data: []byte(`# Gradle settings
+org.gradle.jvmargs=-Xmx4g \
+    -Dfile.encoding=UTF-8
+org.gradle.caching : true
+! old style comment
+org.gradle.parallel false
+project\ name = gradleA
+`)},
+	"env/.env": {Data: []byte(`NODE_ENV=production
+export API_URL="https://example.com/api"
+EMPTY=
+SECRET='a b c'
+`)},
+	"npm/.npmrc": {Data: []byte(`registry=https://registry.npmjs.org/
+//registry.npmjs.org/:_authToken=abc
+@scope:registry = https://npm.example.com/
+`)},
+	"ini/setup.cfg": {Data: []byte(`[metadata]
+name = ini
+version: 1.2.3
+
+[flake8]
+max-line-length = 120
+exclude =
+    .git,
+    build
+  # not a continuation
+`)},
+}
+
+func TestKeyPredicate(t *testing.T) {
+	for _, tc := range []struct {
+		expression string
+		expected   []string
+	}{
+		{`org.gradle.jvmargs`, []string{"gradle"}},
+		{`org.gradle.jvmargs == "-Xmx4g -Dfile.encoding=UTF-8"`, []string{"gradle"}},
+		{`org.gradle.jvmargs =~ Xmx[0-9]+g`, []string{"gradle"}},
+		{`org.gradle.caching == true`, []string{"gradle"}},
+		{`org.gradle.parallel==false`, []string{"gradle"}},
+		{`NODE_ENV != development`, []string{"env"}},
+		{`API_URL =~ ^https://`, []string{"env"}},
+		{`EMPTY`, []string{"env"}},
+		{`EMPTY == ""`, []string{"env"}},
+		{`SECRET == "a b c"`, []string{"env"}},
+		{`//registry.npmjs.org/:_authToken == abc`, []string{"npm"}},
+		{`@scope:registry == https://npm.example.com/`, []string{"npm"}},
+		{`registry =~ npmjs`, []string{"npm"}},
+		{`name`, []string{}},
+		{`[metadata]name == ini`, []string{"ini"}},
+		{`[metadata]version == 1.2.3`, []string{"ini"}},
+		{`[flake8]max-line-length !~ ^(79|80)$`, []string{"ini"}},
+		{`[flake8]exclude == ".git,\nbuild"`, []string{"ini"}},
+		{`[flake8]name`, []string{}},
+	} {
+		predicate, err := ParseKeyPredicate(tc.expression)
+		assert.Nil(t, err, tc.expression)
+		options := fsOptionsForTesting("*")
+		options.Checks = []CheckClause{{Glob: glob.MustCompile("{*.properties,.env,.npmrc,*.cfg}", '/'), Predicates: []ContentPredicate{predicate}}}
+		found, errs := LsHavingFS(keyValueFS, options, ".")
+		assert.Nil(t, errs)
+		assert.Equal(t, tc.expected, found, tc.expression)
+	}
+}
+
+func TestParseKeyValuesEscapedKey(t *testing.T) {
+	values := parseKeyValues("gradle.properties", keyValueFS["gradle/gradle.properties"].Data)
+	assert.Equal(t, "gradleA", values[[2]string{"", "project name"}])
+}
+
+func TestParseKeyPredicateError(t *testing.T) {
+	for _, tc := range []struct {
+		expression string
+		err        string
+	}{
+		{`[section key`, `invalid key expression "[section key": missing "]"`},
+		{`== 1`, `invalid key expression "== 1": missing key`},
+		{`key = 1`, `invalid key expression "key = 1": expecting ==, !=, =~ or !~ but found "= 1"`},
+		{`key =~ (`, "invalid key expression \"key =~ (\": error parsing regexp: missing closing ): `(`"},
+	} {
+		_, err := ParseKeyPredicate(tc.expression)
+		assert.EqualError(t, err, tc.err)
+	}
+}
@@ -4,13 +4,12 @@
 package lsh
 
 import (
+	"context"
 	"io/fs"
-	"os"
-	"path/filepath"
+	"iter"
 	"regexp"
 	"sort"
-
-	"golang.org/x/exp/maps"
+	"time"
 
 	"github.com/gobwas/glob"
 )
@@ -29,13 +28,63 @@ type Options struct {
 	// Exclude root directory in the result to be returned
 	ExcludeRoot bool
 
+	// Name (see Candidate.Name) of each of the directories returned must match any of these patterns.
+	// Unlike Excludes, subdirectories of the directories not matching are still looked into.
+	DirNames []glob.Glob
+
+	// Path of each of the directories returned must match this regular expression, nil means no such requirement.
+	// Unlike Excludes, subdirectories of the directories not matching are still looked into.
+	PathRegexp *regexp.Regexp
+
 	// For any (or each, if MatchAllFlagFiles has value true) of these patterns, each of the directories returned must have at least one file matching it.
+	// If it, FlagPaths and FlagFileTemplates are all empty, directories are not required to have any flag file.
 	FlagFiles []glob.Glob
 
-	// If true then for each of the pattern in FlagFiles, the directory must have at least one file matching.
-	// If false then the directory just need to have at least one file matching any pattern in FlagFiles.
+	// Patterns of paths relative to the directory, such like "src/main/java" or ".github/workflows/*.yml".
+	// They are regarded as flag files in addition to FlagFiles.
+	// Subdirectories matching Excludes are not looked into when finding entries matching them.
+	FlagPaths []*PathPattern
+
+	// Patterns containing placeholders, such like "{dirname}.csproj".
+	// They are expanded for each of the directories and then regarded as flag files in addition to FlagFiles and FlagPaths.
+	FlagFileTemplates []*PatternTemplate
+
+	// If true then for each of the pattern in FlagFiles, FlagPaths and FlagFileTemplates, the directory must have at least one file matching.
+	// If false then the directory just need to have at least one file matching any pattern in FlagFiles, FlagPaths or FlagFileTemplates.
 	MatchAllFlagFiles bool
 
+	// Minimum number of entries matching a pattern in FlagFiles, FlagPaths or FlagFileTemplates for the pattern to be regarded as matched.
+	// Zero is regarded as one.
+	MinFlagFileCount int
+
+	// Maximum number of entries matching a pattern in FlagFiles, FlagPaths or FlagFileTemplates for the pattern to be regarded as matched.
+	// Zero means no limit.
+	MaxFlagFileCount int
+
+	// Types of the entries that can be regarded as flag files, such like EntryTypeFile|EntryTypeDir.
+	// Zero means any type.
+	FlagFileTypes EntryType
+
+	// Additional conditions (such like those created by ModTimeFilter, SizeFilter and ExecutableFilter)
+	// that entries must satisfy to be regarded as flag files
+	FlagFileFilters []EntryFilter
+
+	// None of the files in each of the directories returned can match any of these patterns.
+	AbsentFiles []glob.Glob
+
+	// For each of these patterns, any of the ancestors (see Candidate.Ancestors) of each of the directories returned
+	// must have at least one file matching it.
+	AncestorFlagFiles []glob.Glob
+
+	// For each of these patterns, each of the directories returned must have at least one entry
+	// (in it or in any of its subdirectories, within DescendantDepth) with name matching it.
+	// Subdirectories matching Excludes are not looked into.
+	DescendantFlagFiles []glob.Glob
+
+	// Maximum depth below the directory to look for DescendantFlagFiles.
+	// Entries in the directory have depth 1. Zero or negative value means no limitation on depth.
+	DescendantDepth int
+
 	// Additional file that its content would be checked. Use empty string to skip this checking.
 	CheckFile string
 
@@ -45,8 +94,95 @@ type Options struct {
 	// Regard not matching as positive when using CheckRegexp to check the content of CheckFile
 	CheckInverse bool
 
+	// Additional check files with their own regular expressions.
+	// If CheckFile is not empty, it is regarded as the first one of them.
+	Checks []CheckClause
+
+	// If true then the directory just needs to pass checking of any of the check files.
+	// If false then the directory must pass checking of all of the check files.
+	MatchAnyCheck bool
+
+	// Each of the directories returned must declare dependencies satisfying all of these constraints
+	DependsOn []*DependencyConstraint
+
+	// Command that must exit with code 0 when it is run in each of the directories returned, see CommandMatcher.
+	// It is run only if the directory satisfies all other conditions. Use empty string to skip this checking.
+	CheckCommand string
+
+	// Maximum time that CheckCommand can run in a directory, zero means no limit
+	CheckCommandTimeout time.Duration
+
+	// Maximum number of CheckCommand running at the same time, zero means no limit
+	CheckCommandConcurrency int
+
+	// Custom matcher deciding whether a directory matches conditions.
+	// If it is nil, the matcher built by DefaultMatcher is used.
+	// Otherwise DirNames, PathRegexp, FlagFiles, FlagPaths, FlagFileTemplates, MatchAllFlagFiles, MinFlagFileCount, MaxFlagFileCount,
+	// FlagFileTypes, FlagFileFilters, AbsentFiles, AncestorFlagFiles, DescendantFlagFiles, DescendantDepth,
+	// CheckFile, CheckRegexp, CheckInverse, Checks, MatchAnyCheck, DependsOn, CheckCommand, CheckCommandTimeout and
+	// CheckCommandConcurrency are ignored,
+	// but they can still be combined with the custom matcher, for example:
+	// And(DefaultMatcher(options), customMatcher).
+	// If Concurrency is greater than one, the matcher could be called by multiple goroutines at the same time.
+	Matcher Matcher
+
 	// To return immedately when any error (such like non-existing directory or no access permission) happens
 	PanicOnError bool
+
+	// Maximum number of directories to be looked into concurrently.
+	// Zero or one means looking into directories one by one.
+	// When the value is greater than one, the visit function passed to LsHavingFunc
+	// is still called by one goroutine at a time, but in a less predictable order.
+	Concurrency int
+
+	// The file system to look into.
+	// If it is nil, the file system of the operating system is used.
+	// Otherwise paths (including the root directory, check files and the paths matched by Excludes)
+	// must be slash-separated paths as defined by the io/fs package, such like "." or "a/b".
+	FS fs.FS
+}
+
+// A check file with the regular expression for checking its content
+type CheckClause struct {
+	// Path of the check file relative to the directory.
+	// It is ignored if Glob is not nil.
+	File string
+
+	// Pattern matching names of the entries in the directory.
+	// If it is not nil, each of the entries matching it is checked as the check file.
+	// The checking passes if the content of any of them matches Regexp (and satisfies Predicates),
+	// or, if Inverse is true, if the content of none of them does.
+	Glob glob.Glob
+
+	// Pattern of paths relative to the directory, such like ".github/workflows/*.yml".
+	// If it is not nil, it is used in the same way as Glob, and File and Glob are ignored.
+	Pattern *PathPattern
+
+	// Path or pattern containing placeholders, such like "../{dirname}.md".
+	// If it is not nil, File, Glob and Pattern are ignored, and it is expanded for each of the directories.
+	// The result is used as File if the template has no glob meta character other than those in the placeholders,
+	// otherwise it is used as Glob or Pattern.
+	// When Upward or NearestAncestor is true, it is expanded for the directory rather than for the ancestors.
+	Template *PatternTemplate
+
+	// Regular expression used for checking the content of the check file, nil means matching anything
+	Regexp *regexp.Regexp
+
+	// Additional conditions that the content of the check file must satisfy, such like those created by ParsePathPredicate
+	Predicates []ContentPredicate
+
+	// Regard not matching as positive
+	Inverse bool
+
+	// If true and there is no check file (or entry matching Glob or Pattern) in the directory,
+	// look for it in the ancestors (see Candidate.Ancestors) from the parent directory upward,
+	// and check the one found in the nearest ancestor, such like an inherited .nvmrc file.
+	Upward bool
+
+	// If true, ignore the check file (or entries matching Glob or Pattern) in the directory itself,
+	// and check the one found in the nearest ancestor having it, such like package.json of the workspace that a package is in.
+	// Upward is ignored if it is true.
+	NearestAncestor bool
 }
 
 // Find directories matching conditions.
@@ -55,90 +191,323 @@ type Options struct {
 // it could be an empty array but would never be nil,
 // and the array is sorted in ascend order.
 // If there is no error, the second value returned would be nil.
-// If there is any error, the array of error messages is returned as the second value.
+// If there is any error, the array of errors is returned as the second value.
+// Errors happened when accessing directories or files are of type *PathError,
+// so that the path, the phase, and the underlying error can be examined.
+//
+// A directory found under more than one of the root directories (in case they overlap) is returned only once,
+// even if the root directories are specified in different forms such like relative and absolute paths.
 //
 // If the options tells this function to panic on error,
 // the function would return immediately once there's an error.
 // In such case the first returned value could contain some paths,
-// and the second returned value would contain the error message.
+// and the second returned value would contain the error.
 //
 // If the options tells this function to not panic on error,
 // the function would record the error but continue working in case an error happens.
 // In such case the first returned value would contain all paths found,
-// and the second returned value would contain the error messages.
-func LsHaving(options *Options, rootDir string) (found []string, errors []string) {
+// and the second returned value would contain the errors.
+func LsHaving(options *Options, rootDirs ...string) (found []string, errors []error) {
+	return LsHavingContext(context.Background(), options, rootDirs...)
+}
+
+// Find directories matching conditions, and stop once the context is done.
+//
+// It works in the same way as LsHaving, except that the context is checked
+// before reading each directory and before reading each check file.
+// Once the context is done, the paths found so far are returned as the first value,
+// and the error of the context (context.Canceled or context.DeadlineExceeded)
+// is appended to the errors returned as the second value,
+// regardless of whether the options tells this function to panic on error.
+func LsHavingContext(ctx context.Context, options *Options, rootDirs ...string) (found []string, errors []error) {
 	found = make([]string, 0, 100)
-	errors = make([]string, 0, 10)
 
-	doLsHaving(options, &found, &errors, rootDir, 0, nil) // root dir has depth 0
+	errors = LsHavingFuncContext(ctx, options, func(path string) error {
+		found = append(found, path)
+		return nil
+	}, rootDirs...)
 
 	sort.Strings(found)
-	if len(errors) == 0 {
-		errors = nil
-	}
 	return
 }
 
+// Find directories matching conditions in an fs.FS (such like embed.FS, fstest.MapFS or zip.Reader).
+//
+// It works in the same way as LsHaving, except that the directories are looked into in fsys,
+// and root directories must be slash-separated paths as defined by the io/fs package, such like ".".
+// The options passed in is not modified.
+func LsHavingFS(fsys fs.FS, options *Options, rootDirs ...string) (found []string, errors []error) {
+	optionsWithFS := *options
+	optionsWithFS.FS = fsys
+	return LsHaving(&optionsWithFS, rootDirs...)
+}
+
+// Function to be called for each of the directories found by LsHavingFunc.
+//
+// If the function returns fs.SkipDir, subdirectories of the directory found won't be looked into.
+// If the function returns fs.SkipAll, no more directory would be looked into and LsHavingFunc returns.
+// If the function returns any other non-nil error, LsHavingFunc records the error and returns.
+type VisitFunc func(path string) error
+
+// Find directories matching conditions, and call the visit function for each of them
+// as soon as it is found.
+//
+// Unlike LsHaving, the directories are not sorted.
+// They are passed to the visit function in the order they are found,
+// and a directory is always found before its subdirectories.
+//
+// If there is no error, nil is returned.
+// If there is any error, the array of errors is returned.
+// Errors are handled in the same way as in LsHaving.
+func LsHavingFunc(options *Options, visit VisitFunc, rootDirs ...string) (errors []error) {
+	return LsHavingFuncContext(context.Background(), options, visit, rootDirs...)
+}
+
+// Find directories matching conditions, call the visit function for each of them
+// as soon as it is found, and stop once the context is done.
+//
+// It works in the same way as LsHavingFunc,
+// and the context is handled in the same way as in LsHavingContext.
+func LsHavingFuncContext(ctx context.Context, options *Options, visit VisitFunc, rootDirs ...string) (errors []error) {
+	return LsHavingResultsFunc(ctx, options, func(result *Result) error {
+		return visit(result.Path)
+	}, rootDirs...)
+}
+
+// Find directories matching conditions, and return an iterator over them.
+//
+// Each of the directories found is yielded with a nil error as soon as it is found.
+// Each of the errors is yielded with an empty path as soon as it happens.
+// Directories are yielded in the same order as they would be passed to the visit function of LsHavingFunc.
+// Errors are handled in the same way as in LsHaving.
+// Breaking out of the loop stops looking into any more directory.
+// The body of the loop is always run by the goroutine ranging over the iterator, even if Options.Concurrency is greater than 1.
+func LsHavingSeq(options *Options, rootDirs ...string) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		if options.Concurrency <= 1 {
+			walkYielding(options, rootDirs, yield)
+			return
+		}
+		// directories are found by the worker goroutines, but yield must be called by this goroutine
+		type item struct {
+			path string
+			err  error
+		}
+		items := make(chan item)
+		proceed := make(chan bool)
+		stopped := make(chan emptyStruct)
+		go func() {
+			defer close(items)
+			walkYielding(options, rootDirs, func(path string, err error) bool {
+				select {
+				case items <- item{path, err}:
+				case <-stopped:
+					return false
+				}
+				select {
+				case ok := <-proceed:
+					return ok
+				case <-stopped:
+					return false
+				}
+			})
+		}()
+		defer func() {
+			close(stopped) // also when the body of the loop panics
+			for range items {
+				// wait for the walking to stop
+			}
+		}()
+		for it := range items {
+			if !yield(it.path, it.err) {
+				return
+			}
+			proceed <- true
+		}
+	}
+}
+
+// Walk through the root directories, passing each of the directories found and each of the errors to yield
+func walkYielding(options *Options, rootDirs []string, yield func(string, error) bool) {
+	w := newWalker(context.Background(), options, func(result *Result) error {
+		if !yield(result.Path, nil) {
+			return fs.SkipAll
+		}
+		return nil
+	}, func(err error) bool {
+		return yield("", err) && !options.PanicOnError
+	})
+	w.walk(rootDirs)
+}
+
 type dirEntryEx struct {
-	Path  string
-	Depth int
-	Entry fs.DirEntry
+	Path   string
+	Depth  int
+	Entry  fs.DirEntry
+	Parent *dirNode // nil for the root directory
 }
 
-// Read all entries under the specified directory.
-// The "depth" parameter is the depth of the directory specified by "dir" parameter.
+// A directory that has been looked into, kept for its subdirectories to refer to as an ancestor
+type dirNode struct {
+	path    string
+	depth   int
+	entries []fs.DirEntry
+	parent  *dirNode // nil for the root directory
+}
+
+// Read all entries under the specified directory, and record them in the directory.
 //
 // In case any error happens, the returned values would have an empty array and the error
-func readEntries(dir string, depth int) (*[]dirEntryEx, error) {
-	entries, err := os.ReadDir(dir)
+func readEntries(fsys fileSystem, dir *dirNode) (*[]dirEntryEx, error) {
+	entries, err := fsys.ReadDir(dir.path)
 	if err != nil {
 		return &[]dirEntryEx{}, err
 	}
+	dir.entries = entries
 	entriesEx := make([]dirEntryEx, 0, len(entries))
 	for _, entry := range entries {
-		entriesEx = append(entriesEx, dirEntryEx{filepath.Join(dir, entry.Name()), depth + 1, entry})
+		entriesEx = append(entriesEx, dirEntryEx{fsys.Join(dir.path, entry.Name()), dir.depth + 1, entry, dir})
 	}
 	return &entriesEx, nil
 }
 
-func doLsHaving(options *Options, found *[]string, errors *[]string, dir string, depth int, entriesInDir *[]dirEntryEx) {
-	if entriesInDir == nil { // this must be the root dir
-		rootDirInfo, err := os.Stat(dir)
-		if err != nil {
-			*errors = append(*errors, err.Error())
-			return // If root dir cannot be read, there's no point to continue even if options.PanicOnError == false
-		}
-		rootDirEntryEx := dirEntryEx{dir, 0, fs.FileInfoToDirEntry(rootDirInfo)}
-		entriesInDir, err = readEntries(dir, 0)
-		if err != nil {
-			*errors = append(*errors, err.Error())
-			if options.PanicOnError {
-				return
+// State of looking into the directories
+type walker struct {
+	ctx     context.Context
+	options *Options
+	fsys    fileSystem
+	matcher Matcher
+
+	// The root directory being looked into
+	root string
+
+	// Called for each directory found
+	visit ResultFunc
+
+	// Called for each error, it returns false if no more directory should be looked into
+	report func(err error) bool
+}
+
+func newWalker(ctx context.Context, options *Options, visit ResultFunc, report func(err error) bool) *walker {
+	matcher := options.Matcher
+	if matcher == nil {
+		matcher = DefaultMatcher(options)
+	}
+	return &walker{
+		ctx:     ctx,
+		options: options,
+		fsys:    newFileSystem(options),
+		matcher: matcher,
+		visit:   visit,
+		report:  report,
+	}
+}
+
+// Look into the root directories one by one.
+// If there is more than one root directory,
+// directories found under more than one of them are visited only once.
+func (w *walker) walk(rootDirs []string) {
+	if len(rootDirs) > 1 {
+		visit := w.visit
+		visited := make(map[string]emptyStruct)
+		w.visit = func(result *Result) error {
+			key := w.fsys.Key(result.Path) // so that "a/./b", "a/b" and "/path/to/a/b" are regarded as the same
+			if _, found := visited[key]; found {
+				return nil
 			}
+			visited[key] = emptyVar
+			return visit(result)
+		}
+	}
+	for _, rootDir := range rootDirs {
+		if w.walkRoot(rootDir) != nil {
+			return
 		}
+	}
+}
 
-		if shouldCheck(options, &rootDirEntryEx) {
-			if match(options, &rootDirEntryEx, entriesInDir) {
-				*found = append(*found, rootDirEntryEx.Path)
+// Look into the root directory.
+// fs.SkipAll is returned if no more directory should be looked into.
+func (w *walker) walkRoot(rootDir string) error {
+	w.root = rootDir
+	rootDirInfo, err := w.fsys.Stat(rootDir)
+	if err != nil {
+		if !w.report(&PathError{PhaseRootStat, rootDir, err}) {
+			return fs.SkipAll
+		}
+		return nil // If root dir cannot be read, there's no point to continue even if options.PanicOnError == false
+	}
+	rootDirEntryEx := dirEntryEx{rootDir, 0, fs.FileInfoToDirEntry(rootDirInfo), nil} // root dir has depth 0
+	if w.options.Concurrency > 1 {
+		return w.walkParallel(&rootDirEntryEx, shouldCheck(w.options, &rootDirEntryEx))
+	}
+	return w.walkDir(&rootDirEntryEx, shouldCheck(w.options, &rootDirEntryEx))
+}
+
+// Check the directory (if checkDir is true) and then look into its subdirectories.
+// fs.SkipAll is returned if no more directory should be looked into.
+func (w *walker) walkDir(dir *dirEntryEx, checkDir bool) error {
+	subDirs, err := w.checkDir(dir, checkDir)
+	if err != nil {
+		return err
+	}
+	for i := range subDirs {
+		if err := w.walkDir(&subDirs[i], true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check the directory (if checkDir is true) and find its subdirectories that should be looked into.
+// fs.SkipAll is returned if no more directory should be looked into.
+func (w *walker) checkDir(dir *dirEntryEx, checkDir bool) (subDirs []dirEntryEx, err error) {
+	if w.cancelled() {
+		return nil, fs.SkipAll
+	}
+	entriesInDir, err := readEntries(w.fsys, &dirNode{dir.Path, dir.Depth, nil, dir.Parent})
+	if err != nil && !w.report(&PathError{PhaseReadDir, dir.Path, err}) {
+		return nil, fs.SkipAll
+	}
+
+	var result *Result
+	if checkDir {
+		if result, err = w.match(dir, entriesInDir); err != nil {
+			return nil, err
+		}
+	}
+	if w.cancelled() { // match could have been interrupted
+		return nil, fs.SkipAll
+	}
+	if result != nil {
+		if err := w.visit(result); err != nil {
+			switch err {
+			case fs.SkipDir:
+				return nil, nil
+			case fs.SkipAll:
+				return nil, fs.SkipAll
+			default:
+				w.report(err)
+				return nil, fs.SkipAll
 			}
 		}
 	}
 
 	for _, entry := range *entriesInDir {
-		if shouldCheck(options, &entry) {
-			entriesInSubDir, err := readEntries(entry.Path, entry.Depth)
-			if err != nil {
-				*errors = append(*errors, err.Error())
-				if options.PanicOnError {
-					return
-				}
-			}
-			if match(options, &entry, entriesInSubDir) {
-				*found = append(*found, entry.Path)
-			}
-			doLsHaving(options, found, errors, entry.Path, entry.Depth, entriesInSubDir)
+		if shouldCheck(w.options, &entry) {
+			subDirs = append(subDirs, entry)
 		}
 	}
+	return subDirs, nil
+}
+
+// Report the error of the context if it is done
+func (w *walker) cancelled() bool {
+	if err := w.ctx.Err(); err != nil {
+		w.report(err)
+		return true
+	}
+	return false
 }
 
 func shouldCheck(options *Options, dir *dirEntryEx) bool {
@@ -154,54 +523,41 @@ func shouldCheck(options *Options, dir *dirEntryEx) bool {
 	return true
 }
 
-func match(options *Options, dir *dirEntryEx, entries *[]dirEntryEx) bool {
-	if options.ExcludeRoot && dir.Depth == 0 {
-		return false
+// Check whether the directory matches conditions.
+// If it matches, details are returned, otherwise nil is returned.
+// fs.SkipAll is returned as the error if no more directory should be looked into.
+func (w *walker) match(dir *dirEntryEx, entries *[]dirEntryEx) (*Result, error) {
+	if w.options.ExcludeRoot && dir.Depth == 0 {
+		return nil, nil
 	}
 
-	foundFlagFile := false
-	if options.MatchAllFlagFiles { // all globs must have matches
-		allMatched := make(map[int]emptyStruct)
-		for _, entry := range *entries {
-			matched := allMatchingGlobs(options.FlagFiles, entry.Entry.Name())
-			maps.Copy(allMatched, matched)
-		}
-		foundFlagFile = len(allMatched) == len(options.FlagFiles)
-	} else { // just need one glob to have a match
-		for _, entry := range *entries {
-			if anyGlobMatch(options.FlagFiles, entry.Entry.Name()) {
-				foundFlagFile = true
-				break
-			}
-		}
+	candidate := &Candidate{
+		Path:    dir.Path,
+		Depth:   dir.Depth,
+		Entries: make([]fs.DirEntry, len(*entries)),
+		Result: &Result{
+			Root:  w.root,
+			Path:  dir.Path,
+			Depth: dir.Depth,
+		},
+		ctx:      w.ctx,
+		fsys:     w.fsys,
+		excludes: w.options.Excludes,
+		parent:   dir.Parent,
 	}
-	if !foundFlagFile { // no need to test CheckFile
-		return false
+	for i, entry := range *entries {
+		candidate.Entries[i] = entry.Entry
 	}
 
-	var checkFileMismatch bool
-	if options.CheckFile == "" {
-		checkFileMismatch = false
-	} else {
-		checkFilePath := filepath.Join(dir.Path, options.CheckFile)
-		checkFileDirInfo, err := os.Stat(checkFilePath)
-		if err != nil {
-			// can't find or cannot read check file/dir
-			checkFileMismatch = !options.CheckInverse
-		} else {
-			if checkFileDirInfo.IsDir() { // it is a directory
-				// ".*" is the default matching all expression
-				checkFileMismatch = options.CheckRegexp.String() == ".*" == options.CheckInverse
-			} else { // it is a file
-				checkFileContent, err := os.ReadFile(checkFilePath)
-				if err != nil {
-					checkFileMismatch = true
-				} else {
-					checkFileMismatch = !options.CheckRegexp.Match(checkFileContent)
-					checkFileMismatch = checkFileMismatch != options.CheckInverse
-				}
-			}
+	matched, err := w.matcher.Match(candidate)
+	if err != nil {
+		if w.ctx.Err() == nil && !w.report(err) { // error of the context would be reported by the caller
+			return nil, fs.SkipAll
 		}
+		return nil, nil
+	}
+	if !matched {
+		return nil, nil
 	}
-	return !checkFileMismatch
+	return candidate.Result, nil
 }
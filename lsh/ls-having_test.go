@@ -0,0 +1,407 @@
+package lsh
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gobwas/glob"
+	"github.com/stretchr/testify/assert"
+)
+
+const repo1 = "../testdata/repo1"
+
+func optionsForTesting(flagFiles ...string) *Options {
+	globs := make([]glob.Glob, len(flagFiles))
+	for i, flagFile := range flagFiles {
+		globs[i] = glob.MustCompile(flagFile, filepath.Separator)
+	}
+	return &Options{
+		Depth:       -1,
+		Excludes:    []glob.Glob{glob.MustCompile(filepath.Join("**", "node_modules"), filepath.Separator)},
+		FlagFiles:   globs,
+		CheckRegexp: regexp.MustCompile(".*"),
+	}
+}
+
+func TestLsHavingFuncVisitsParentBeforeSubdirectories(t *testing.T) {
+	var visited []string
+	errs := LsHavingFunc(optionsForTesting("package.json"), func(path string) error {
+		visited = append(visited, path)
+		return nil
+	}, repo1)
+	assert.Nil(t, errs)
+	assert.ElementsMatch(t, []string{
+		repo1,
+		repo1 + "/inbound",
+		repo1 + "/outbound/New Zealand",
+		repo1 + "/outbound/china",
+		repo1 + "/outbound/china/mainland",
+	}, visited)
+	assert.Equal(t, repo1, visited[0])
+	assert.Less(t, indexOf(visited, repo1+"/outbound/china"), indexOf(visited, repo1+"/outbound/china/mainland"))
+}
+
+func TestLsHavingFuncSkipDir(t *testing.T) {
+	var visited []string
+	errs := LsHavingFunc(optionsForTesting("package.json"), func(path string) error {
+		visited = append(visited, path)
+		if path == repo1+"/outbound/china" {
+			return fs.SkipDir
+		}
+		return nil
+	}, repo1)
+	assert.Nil(t, errs)
+	assert.Contains(t, visited, repo1+"/outbound/china")
+	assert.NotContains(t, visited, repo1+"/outbound/china/mainland")
+	assert.Contains(t, visited, repo1+"/inbound")
+}
+
+func TestLsHavingFuncSkipAll(t *testing.T) {
+	var visited []string
+	errs := LsHavingFunc(optionsForTesting("package.json"), func(path string) error {
+		visited = append(visited, path)
+		return fs.SkipAll
+	}, repo1)
+	assert.Nil(t, errs)
+	assert.Equal(t, []string{repo1}, visited)
+}
+
+func TestLsHavingFuncVisitError(t *testing.T) {
+	visits := 0
+	errs := LsHavingFunc(optionsForTesting("package.json"), func(path string) error {
+		visits++
+		return errors.New("visit failed")
+	}, repo1)
+	assert.Equal(t, []error{errors.New("visit failed")}, errs)
+	assert.Equal(t, 1, visits)
+}
+
+func TestLsHavingSeq(t *testing.T) {
+	var visited []string
+	for path, err := range LsHavingSeq(optionsForTesting("serverless.*"), repo1) {
+		assert.Nil(t, err)
+		visited = append(visited, path)
+	}
+	assert.ElementsMatch(t, []string{
+		repo1 + "/inbound",
+		repo1 + "/outbound/New Zealand",
+		repo1 + "/outbound/australia",
+		repo1 + "/outbound/china/sars",
+	}, visited)
+}
+
+func TestLsHavingSeqBreak(t *testing.T) {
+	count := 0
+	for range LsHavingSeq(optionsForTesting("package.json"), repo1) {
+		count++
+		if count == 2 {
+			break
+		}
+	}
+	assert.Equal(t, 2, count)
+}
+
+func TestLsHavingSeqYieldsErrors(t *testing.T) {
+	var errs []error
+	for path, err := range LsHavingSeq(optionsForTesting("package.json"), repo1+"/non-existing-dir") {
+		assert.Equal(t, "", path)
+		errs = append(errs, err)
+	}
+	assert.Len(t, errs, 1)
+	assert.ErrorIs(t, errs[0], fs.ErrNotExist)
+}
+
+func indexOf(paths []string, path string) int {
+	for i, p := range paths {
+		if p == path {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestLsHavingContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var visited []string
+	errs := LsHavingFuncContext(ctx, optionsForTesting("package.json"), func(path string) error {
+		visited = append(visited, path)
+		cancel()
+		return nil
+	}, repo1)
+	assert.Equal(t, []string{repo1}, visited)
+	assert.Equal(t, []error{context.Canceled}, errs)
+}
+
+func TestLsHavingContextDeadlineExceeded(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	found, errs := LsHavingContext(ctx, optionsForTesting("package.json"), repo1)
+	assert.Empty(t, found)
+	assert.NotNil(t, found)
+	assert.Equal(t, []error{context.DeadlineExceeded}, errs)
+}
+
+func TestLsHavingConcurrency(t *testing.T) {
+	for _, flagFile := range []string{"package.json", "serverless.*", "build.gradle*", "*"} {
+		options := optionsForTesting(flagFile)
+		options.Excludes = nil
+		expected, expectedErrs := LsHaving(options, repo1)
+		options.Concurrency = 4
+		found, errs := LsHaving(options, repo1)
+		assert.Equal(t, expected, found, flagFile)
+		assert.Equal(t, expectedErrs, errs, flagFile)
+	}
+}
+
+func TestLsHavingConcurrencySkipAll(t *testing.T) {
+	options := optionsForTesting("*")
+	options.Concurrency = 4
+	visits := 0
+	errs := LsHavingFunc(options, func(path string) error {
+		visits++
+		return fs.SkipAll
+	}, repo1)
+	assert.Nil(t, errs)
+	assert.Equal(t, 1, visits)
+}
+
+func TestLsHavingConcurrencySeqBreak(t *testing.T) {
+	options := optionsForTesting("*")
+	options.Concurrency = 4
+	count := 0
+	for range LsHavingSeq(options, repo1) {
+		count++
+		if count == 3 {
+			break
+		}
+	}
+	assert.Equal(t, 3, count)
+}
+
+func TestLsHavingConcurrencySeqPanic(t *testing.T) {
+	options := optionsForTesting("serverless.yml") // not in the root directory, so found by the worker goroutines
+	options.Concurrency = 4
+	recovered := func() (recovered any) {
+		defer func() { recovered = recover() }()
+		for range LsHavingSeq(options, repo1) {
+			panic("panic in the loop body")
+		}
+		return nil
+	}()
+	assert.Equal(t, "panic in the loop body", recovered)
+}
+
+var mapFS = fstest.MapFS{
+	"package.json":                              {Data: []byte(`{"name": "root"}`)},
+	"apps/web/package.json":                     {Data: []byte(`{"name": "web", "dependencies": {"react": "^18.0.0"}}`)},
+	"apps/web/tsconfig.json":                    {Data: []byte(`{}`)},
+	"apps/api/package.json":                     {Data: []byte(`{"name": "api"}`)},
+	"apps/api/serverless.yml":                   {Data: []byte(`service: api`)},
+	"apps/api/node_modules/lib/package.json":    {Data: []byte(`{"name": "lib"}`)},
+	"libs/shared/build.gradle":                  {Data: []byte(`apply plugin: 'java'`)},
+	"libs/shared/src/main/java/Shared.java":     {Data: []byte(`class Shared {}`)},
+	"libs/shared/src/test/java/SharedTest.java": {Data: []byte(`class SharedTest {}`)},
+}
+
+func fsOptionsForTesting(flagFiles ...string) *Options {
+	options := optionsForTesting()
+	for _, flagFile := range flagFiles {
+		options.FlagFiles = append(options.FlagFiles, glob.MustCompile(flagFile, '/'))
+	}
+	options.Excludes = []glob.Glob{glob.MustCompile("**/node_modules", '/')}
+	return options
+}
+
+func TestLsHavingFS(t *testing.T) {
+	found, errs := LsHavingFS(mapFS, fsOptionsForTesting("package.json"), ".")
+	assert.Nil(t, errs)
+	assert.Equal(t, []string{".", "apps/api", "apps/web"}, found)
+}
+
+func TestLsHavingFSSubdirectory(t *testing.T) {
+	found, errs := LsHavingFS(mapFS, fsOptionsForTesting("package.json", "build.gradle"), "apps")
+	assert.Nil(t, errs)
+	assert.Equal(t, []string{"apps/api", "apps/web"}, found)
+}
+
+func TestLsHavingFSCheckFile(t *testing.T) {
+	options := fsOptionsForTesting("package.json")
+	options.CheckFile = "package.json"
+	options.CheckRegexp = regexp.MustCompile(`"react"`)
+	found, errs := LsHavingFS(mapFS, options, ".")
+	assert.Nil(t, errs)
+	assert.Equal(t, []string{"apps/web"}, found)
+
+	options.CheckFile = "../web/tsconfig.json"
+	options.CheckRegexp = regexp.MustCompile(".*")
+	found, errs = LsHavingFS(mapFS, options, ".")
+	assert.Nil(t, errs)
+	assert.Equal(t, []string{"apps/api", "apps/web"}, found)
+}
+
+func TestLsHavingFSNonExistingRoot(t *testing.T) {
+	found, errs := LsHavingFS(mapFS, fsOptionsForTesting("package.json"), "non-existing-dir")
+	assert.Empty(t, found)
+	assert.Len(t, errs, 1)
+}
+
+func TestLsHavingPathError(t *testing.T) {
+	_, errs := LsHaving(optionsForTesting("package.json"), repo1+"/non-existing-dir")
+	assert.Len(t, errs, 1)
+	var pathError *PathError
+	assert.ErrorAs(t, errs[0], &pathError)
+	assert.Equal(t, PhaseRootStat, pathError.Phase)
+	assert.Equal(t, repo1+"/non-existing-dir", pathError.Path)
+	assert.ErrorIs(t, errs[0], fs.ErrNotExist)
+	assert.NotErrorIs(t, errs[0], fs.ErrPermission)
+	assert.Equal(t, "stat "+repo1+"/non-existing-dir: no such file or directory", errs[0].Error())
+}
+
+func TestLsHavingPathErrorReadDir(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/package.json": {Data: []byte(`{}`)},
+		"a/locked":       {Mode: fs.ModeDir},
+	}
+	options := fsOptionsForTesting("package.json")
+	options.FS = permissionDeniedFS{fsys, "a/locked"}
+	found, errs := LsHaving(options, ".")
+	assert.Equal(t, []string{"a"}, found)
+	assert.Len(t, errs, 1)
+	var pathError *PathError
+	assert.ErrorAs(t, errs[0], &pathError)
+	assert.Equal(t, PhaseReadDir, pathError.Phase)
+	assert.Equal(t, "a/locked", pathError.Path)
+	assert.ErrorIs(t, errs[0], fs.ErrPermission)
+}
+
+func TestLsHavingPathErrorCheckFile(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/package.json": {Data: []byte(`{}`)},
+		"b/package.json": {Data: []byte(`{}`)},
+	}
+	options := fsOptionsForTesting("package.json")
+	options.CheckFile = "package.json"
+	options.FS = permissionDeniedFS{fsys, "a/package.json"}
+	found, errs := LsHaving(options, ".")
+	assert.Equal(t, []string{"b"}, found)
+	assert.Len(t, errs, 1)
+	var pathError *PathError
+	assert.ErrorAs(t, errs[0], &pathError)
+	assert.Equal(t, PhaseReadCheckFile, pathError.Phase)
+	assert.Equal(t, "a/package.json", pathError.Path)
+	assert.ErrorIs(t, errs[0], fs.ErrPermission)
+
+	options.PanicOnError = true
+	options.FS = permissionDeniedFS{fsys, "b/package.json"}
+	found, errs = LsHaving(options, ".")
+	assert.Equal(t, []string{"a"}, found)
+	assert.Len(t, errs, 1)
+}
+
+// An fs.FS that denies opening one of the paths
+type permissionDeniedFS struct {
+	fsys   fstest.MapFS
+	denied string
+}
+
+func (f permissionDeniedFS) Open(name string) (fs.File, error) {
+	if name == f.denied {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return f.fsys.Open(name)
+}
+
+func TestLsHavingResults(t *testing.T) {
+	options := fsOptionsForTesting("package.json", "*.yml", "build.gradle")
+	options.CheckFile = "tsconfig.json"
+	options.CheckInverse = true
+	options.FS = mapFS
+	found, errs := LsHavingResults(context.Background(), options, ".")
+	assert.Nil(t, errs)
+	assert.Equal(t, []*Result{
+		{
+			Root:      ".",
+			Path:      ".",
+			Depth:     0,
+			FlagFiles: [][]string{{"package.json"}, nil, nil},
+			Checks:    []CheckResult{{File: "tsconfig.json", Outcome: CheckFileMissing, Clause: -1}},
+		},
+		{
+			Root:      ".",
+			Path:      "apps/api",
+			Depth:     2,
+			FlagFiles: [][]string{{"package.json"}, {"serverless.yml"}, nil},
+			Checks:    []CheckResult{{File: "apps/api/tsconfig.json", Outcome: CheckFileMissing, Clause: -1}},
+		},
+		{
+			Root:      ".",
+			Path:      "libs/shared",
+			Depth:     2,
+			FlagFiles: [][]string{nil, nil, {"build.gradle"}},
+			Checks:    []CheckResult{{File: "libs/shared/tsconfig.json", Outcome: CheckFileMissing, Clause: -1}},
+		},
+	}, found)
+}
+
+func TestLsHavingMultipleRootDirs(t *testing.T) {
+	found, errs := LsHavingFS(mapFS, fsOptionsForTesting("package.json", "build.gradle"), "libs", "apps/web", "apps")
+	assert.Nil(t, errs)
+	assert.Equal(t, []string{"apps/api", "apps/web", "libs/shared"}, found)
+}
+
+func TestLsHavingMultipleRootDirsOverlapping(t *testing.T) {
+	options := fsOptionsForTesting("package.json")
+	options.FS = mapFS
+	found, errs := LsHavingResults(context.Background(), options, "apps", ".", "apps/web")
+	assert.Nil(t, errs)
+	paths := make([]string, len(found))
+	roots := make([]string, len(found))
+	for i, result := range found {
+		paths[i], roots[i] = result.Path, result.Root
+	}
+	assert.Equal(t, []string{".", "apps/api", "apps/web"}, paths)
+	assert.Equal(t, []string{".", "apps", "apps"}, roots)
+}
+
+func TestLsHavingMultipleRootDirsRelativeAndAbsolute(t *testing.T) {
+	abs, err := filepath.Abs(repo1 + "/outbound/china")
+	assert.Nil(t, err)
+	found, errs := LsHaving(optionsForTesting("package.json"), repo1+"/outbound/china", abs)
+	assert.Nil(t, errs)
+	assert.Equal(t, []string{repo1 + "/outbound/china", repo1 + "/outbound/china/mainland"}, found)
+}
+
+func TestLsHavingMultipleRootDirsWithError(t *testing.T) {
+	options := fsOptionsForTesting("package.json")
+	found, errs := LsHavingFS(mapFS, options, "non-existing-dir", "apps")
+	assert.Equal(t, []string{"apps/api", "apps/web"}, found)
+	assert.Len(t, errs, 1)
+
+	options.PanicOnError = true
+	found, errs = LsHavingFS(mapFS, options, "non-existing-dir", "apps")
+	assert.Empty(t, found)
+	assert.Len(t, errs, 1)
+}
+
+func TestLsHavingMultipleRootDirsConcurrency(t *testing.T) {
+	options := fsOptionsForTesting("package.json", "build.gradle")
+	options.Concurrency = 3
+	found, errs := LsHavingFS(mapFS, options, "libs", "apps/web", "apps")
+	assert.Nil(t, errs)
+	assert.Equal(t, []string{"apps/api", "apps/web", "libs/shared"}, found)
+}
+
+func TestLsHavingMultipleRootDirsNotCleaned(t *testing.T) {
+	found, errs := LsHaving(optionsForTesting("package.json"), repo1+"/outbound", "./"+repo1+"/outbound/china")
+	assert.Nil(t, errs)
+	assert.Equal(t, []string{
+		repo1 + "/outbound/New Zealand",
+		repo1 + "/outbound/china",
+		repo1 + "/outbound/china/mainland",
+	}, found)
+}
@@ -0,0 +1,487 @@
+package lsh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"strconv"
+
+	"github.com/gobwas/glob"
+)
+
+// A directory being checked by matchers
+type Candidate struct {
+	// Path of the directory
+	Path string
+
+	// Depth of the directory, the root directory has depth 0
+	Depth int
+
+	// Entries in the directory
+	Entries []fs.DirEntry
+
+	// Details to be returned if the directory matches.
+	// Matchers could record in it why the directory matches.
+	Result *Result
+
+	ctx      context.Context
+	fsys     fileSystem
+	excludes []glob.Glob
+	parent   *dirNode
+}
+
+// The context of looking into directories
+func (c *Candidate) Context() context.Context {
+	return c.ctx
+}
+
+// Name of the directory, which is the last element of Path.
+// For the file system of the operating system, paths like "." are resolved to absolute paths first.
+func (c *Candidate) Name() string {
+	return c.fsys.Base(c.Path)
+}
+
+// Path of a file relative to the directory, such like "package.json" or "../README.md"
+func (c *Candidate) Join(name string) string {
+	return c.fsys.Join(c.Path, name)
+}
+
+// Get information of a file relative to the directory
+func (c *Candidate) Stat(name string) (fs.FileInfo, error) {
+	return c.fsys.Stat(c.Join(name))
+}
+
+// Read the content of a file relative to the directory
+func (c *Candidate) ReadFile(name string) ([]byte, error) {
+	return c.fsys.ReadFile(c.Join(name))
+}
+
+// Ancestors of the directory, from the parent directory up to the root directory being looked into.
+// Directories above the root directory are not included, so that the root directory has no ancestor.
+// Matchers can be applied to the ancestors, but what they record in Result of the ancestors is discarded.
+func (c *Candidate) Ancestors() []*Candidate {
+	var ancestors []*Candidate
+	for node := c.parent; node != nil; node = node.parent {
+		ancestors = append(ancestors, &Candidate{
+			Path:    node.path,
+			Depth:   node.depth,
+			Entries: node.entries,
+			Result: &Result{
+				Root:  c.Result.Root,
+				Path:  node.path,
+				Depth: node.depth,
+			},
+			ctx:      c.ctx,
+			fsys:     c.fsys,
+			excludes: c.excludes,
+			parent:   node.parent,
+		})
+	}
+	return ancestors
+}
+
+// Predicate deciding whether a directory matches conditions
+type Matcher interface {
+	// Check whether the directory matches.
+	// If an error is returned, the directory is regarded as not matching,
+	// and the error is handled in the same way as errors like failing to read a directory.
+	Match(dir *Candidate) (bool, error)
+}
+
+// Function that can be used as a Matcher
+type MatcherFunc func(dir *Candidate) (bool, error)
+
+func (f MatcherFunc) Match(dir *Candidate) (bool, error) {
+	return f(dir)
+}
+
+// Build the matcher according to DirNames, PathRegexp, FlagFiles, FlagPaths, FlagFileTemplates, MatchAllFlagFiles, MinFlagFileCount,
+// MaxFlagFileCount, FlagFileTypes, FlagFileFilters, AbsentFiles, AncestorFlagFiles, DescendantFlagFiles, DescendantDepth,
+// CheckFile, CheckRegexp, CheckInverse, Checks, MatchAnyCheck, DependsOn, CheckCommand, CheckCommandTimeout
+// and CheckCommandConcurrency of the options.
+// Conditions are evaluated in that order, so that the check command is run only when all other conditions are satisfied.
+// It is the matcher used when Options.Matcher is nil.
+func DefaultMatcher(options *Options) Matcher {
+	var matchers []Matcher
+	if len(options.DirNames) > 0 {
+		matchers = append(matchers, DirNameMatcher(options.DirNames))
+	}
+	if options.PathRegexp != nil {
+		matchers = append(matchers, PathRegexpMatcher(options.PathRegexp))
+	}
+	if len(options.FlagFiles) > 0 || len(options.FlagPaths) > 0 || len(options.FlagFileTemplates) > 0 {
+		var filters []EntryFilter
+		if options.FlagFileTypes != 0 {
+			filters = append(filters, EntryTypeFilter(options.FlagFileTypes))
+		}
+		filters = append(filters, options.FlagFileFilters...)
+		matchers = append(matchers, flagEntriesMatcher(options.FlagFiles, options.FlagPaths, options.FlagFileTemplates, options.MatchAllFlagFiles,
+			options.MinFlagFileCount, options.MaxFlagFileCount, filters))
+	}
+	if len(options.AbsentFiles) > 0 {
+		matchers = append(matchers, AbsentFilesMatcher(options.AbsentFiles))
+	}
+	for _, ancestorFlagFile := range options.AncestorFlagFiles {
+		matchers = append(matchers, AncestorMatcher(FlagFilesMatcher([]glob.Glob{ancestorFlagFile}, false)))
+	}
+	if len(options.DescendantFlagFiles) > 0 {
+		matchers = append(matchers, DescendantMatcher(options.DescendantFlagFiles, options.DescendantDepth))
+	}
+	var checkMatchers []Matcher
+	if options.CheckFile != "" {
+		checkMatchers = append(checkMatchers, CheckFileMatcher(options.CheckFile, options.CheckRegexp, options.CheckInverse))
+	}
+	for i, clause := range options.Checks {
+		checkMatchers = append(checkMatchers, checkClauseMatcher(clause, i))
+	}
+	if len(checkMatchers) > 0 {
+		if options.MatchAnyCheck {
+			matchers = append(matchers, Or(checkMatchers...))
+		} else {
+			matchers = append(matchers, And(checkMatchers...))
+		}
+	}
+	if len(options.DependsOn) > 0 {
+		matchers = append(matchers, DependsOnMatcher(options.DependsOn))
+	}
+	if options.CheckCommand != "" {
+		matchers = append(matchers, CommandMatcher(options.CheckCommand, options.CheckCommandTimeout, options.CheckCommandConcurrency))
+	}
+	return And(matchers...)
+}
+
+// Matcher requiring any (or each, if all is true) of the globs to have at least one entry in the directory matching it.
+// If there are filters, entries not accepted by all of them are ignored.
+// Names of the entries matching are recorded in Result.FlagFiles.
+func FlagFilesMatcher(globs []glob.Glob, all bool, filters ...EntryFilter) Matcher {
+	return flagEntriesMatcher(globs, nil, nil, all, 1, 0, filters)
+}
+
+// Matcher requiring any (or each, if all is true) of the path patterns to have at least one entry under the directory matching it.
+// If there are filters, entries not accepted by all of them are ignored.
+// Paths (relative to the directory) of the entries matching are recorded in Result.FlagFiles.
+func FlagPathsMatcher(patterns []*PathPattern, all bool, filters ...EntryFilter) Matcher {
+	return flagEntriesMatcher(nil, patterns, nil, all, 1, 0, filters)
+}
+
+// Matcher requiring any (or each, if all is true) of the templates, expanded for the directory,
+// to have at least one entry in (or under) the directory matching it.
+// If there are filters, entries not accepted by all of them are ignored.
+// Names (or relative paths) of the entries matching are recorded in Result.FlagFiles.
+func FlagFileTemplatesMatcher(templates []*PatternTemplate, all bool, filters ...EntryFilter) Matcher {
+	return flagEntriesMatcher(nil, nil, templates, all, 1, 0, filters)
+}
+
+// Matcher requiring any (or each, if all is true) of the globs, the path patterns and the templates
+// to have at least minCount (and at most maxCount, if it is greater than zero) entries matching it
+func flagEntriesMatcher(globs []glob.Glob, patterns []*PathPattern, templates []*PatternTemplate, all bool, minCount, maxCount int, filters []EntryFilter) Matcher {
+	return MatcherFunc(func(dir *Candidate) (bool, error) {
+		flagFiles, err := findFlagFiles(dir, globs, filters)
+		for _, pattern := range patterns {
+			if err != nil {
+				break
+			}
+			var paths []string
+			paths, err = pattern.find(dir, filters)
+			flagFiles = append(flagFiles, paths)
+		}
+		for _, template := range templates {
+			if err != nil {
+				break
+			}
+			var names []string
+			names, err = findTemplateFlagFiles(dir, template, filters)
+			flagFiles = append(flagFiles, names)
+		}
+		for i, names := range flagFiles {
+			if len(names) < minCount || maxCount > 0 && len(names) > maxCount {
+				flagFiles[i] = nil // regarded as not matched
+			}
+		}
+		dir.Result.FlagFiles = flagFiles
+		return err == nil && flagFilesFound(flagFiles, all), err
+	})
+}
+
+// For each of the globs, find names of the entries in the directory matching it and accepted by the filters
+func findFlagFiles(dir *Candidate, globs []glob.Glob, filters []EntryFilter) ([][]string, error) {
+	flagFiles := make([][]string, len(globs))
+	for _, entry := range dir.Entries {
+		matchingGlobs := allMatchingGlobs(globs, entry.Name())
+		if len(matchingGlobs) == 0 {
+			continue
+		}
+		if accepted, err := acceptedByFilters(dir, entry.Name(), entry, filters); err != nil || !accepted {
+			if err != nil {
+				return flagFiles, err
+			}
+			continue
+		}
+		for i := range matchingGlobs {
+			flagFiles[i] = append(flagFiles[i], entry.Name())
+		}
+	}
+	return flagFiles, nil
+}
+
+// Check whether any (or each, if all is true) of the globs has at least one entry matching it
+func flagFilesFound(flagFiles [][]string, all bool) bool {
+	matchedGlobs := 0
+	for _, names := range flagFiles {
+		if names != nil {
+			matchedGlobs++
+		}
+	}
+	if all { // all globs must have matches
+		return matchedGlobs == len(flagFiles)
+	}
+	return matchedGlobs > 0 // just need one glob to have a match
+}
+
+// Matcher requiring the name (see Candidate.Name) of the directory to match any of the globs
+func DirNameMatcher(globs []glob.Glob) Matcher {
+	return MatcherFunc(func(dir *Candidate) (bool, error) {
+		return anyGlobMatch(globs, dir.Name()), nil
+	})
+}
+
+// Matcher requiring the path of the directory to match the regular expression
+func PathRegexpMatcher(pathRegexp *regexp.Regexp) Matcher {
+	return MatcherFunc(func(dir *Candidate) (bool, error) {
+		return pathRegexp.MatchString(dir.Path), nil
+	})
+}
+
+// Matcher requiring none of the entries in the directory to match any of the globs
+func AbsentFilesMatcher(globs []glob.Glob) Matcher {
+	return MatcherFunc(func(dir *Candidate) (bool, error) {
+		for _, entry := range dir.Entries {
+			if anyGlobMatch(globs, entry.Name()) {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+}
+
+// Matcher requiring the content of the check file to match the regular expression (or not match, if inverse is true).
+// The check file is a path relative to the directory, and it could be a directory.
+// A nil regular expression matches anything.
+// The path and the outcome of checking are appended to Result.Checks.
+func CheckFileMatcher(checkFile string, checkRegexp *regexp.Regexp, inverse bool) Matcher {
+	return CheckClauseMatcher(CheckClause{File: checkFile, Regexp: checkRegexp, Inverse: inverse})
+}
+
+// Matcher requiring the check file (or the entries matching the glob or the path pattern) of the clause to pass checking.
+// If Upward of the clause is true and there is no such file in the directory, the nearest ancestor having it is checked instead.
+// If NearestAncestor of the clause is true, the nearest ancestor having such file is checked, regardless of the directory itself.
+// Paths and outcomes of checking are appended to Result.Checks, with CheckResult.Clause being -1.
+func CheckClauseMatcher(clause CheckClause) Matcher {
+	return checkClauseMatcher(clause, -1)
+}
+
+// Matcher of the clause, recording the index of the clause in CheckResult.Clause
+func checkClauseMatcher(clause CheckClause, index int) Matcher {
+	return MatcherFunc(func(dir *Candidate) (bool, error) {
+		if clause.Template != nil {
+			expanded, err := expandCheckClause(dir, clause)
+			if err != nil {
+				return false, err
+			}
+			return checkClauseMatcher(expanded, index).Match(dir)
+		}
+		checked := len(dir.Result.Checks)
+		passed, err := checkClause(dir, clause)
+		for i := checked; i < len(dir.Result.Checks); i++ {
+			dir.Result.Checks[i].Clause = index
+		}
+		return passed, err
+	})
+}
+
+// Check the clause in the directory (and its ancestors, if needed), and append paths and outcomes of checking to the result
+func checkClause(dir *Candidate, clause CheckClause) (bool, error) {
+	searched := []*Candidate{dir}
+	if clause.NearestAncestor {
+		searched = dir.Ancestors()
+	} else if clause.Upward {
+		searched = append(searched, dir.Ancestors()...)
+	}
+	for _, d := range searched {
+		passed, found, err := checkClauseIn(d, dir.Result, clause)
+		if err != nil || found {
+			return passed, err
+		}
+	}
+	if clause.Glob == nil && clause.Pattern == nil {
+		dir.Result.Checks = append(dir.Result.Checks, CheckResult{File: dir.Join(clause.File), Outcome: CheckFileMissing})
+	}
+	return clause.Inverse, nil
+}
+
+// Check the check file (or the entries matching the glob or the path pattern) of the clause in the directory,
+// and append paths and outcomes of checking to the result.
+// If there is no such file in the directory, found is false and nothing is appended.
+func checkClauseIn(dir *Candidate, result *Result, clause CheckClause) (passed, found bool, err error) {
+	var checkFiles []string
+	switch {
+	case clause.Pattern != nil:
+		paths, err := clause.Pattern.find(dir, nil)
+		if err != nil {
+			return false, true, err
+		}
+		checkFiles = paths
+	case clause.Glob != nil:
+		for _, entry := range dir.Entries {
+			if clause.Glob.Match(entry.Name()) {
+				checkFiles = append(checkFiles, entry.Name())
+			}
+		}
+	default:
+		checkResult, err := checkCheckFile(dir, clause.File, clause.Regexp, clause.Predicates)
+		if checkResult.Outcome == CheckFileMissing && err == nil {
+			return false, false, nil
+		}
+		result.Checks = append(result.Checks, checkResult)
+		return checkPassed(checkResult.Outcome, clause.Regexp, clause.Inverse), true, err
+	}
+	for _, checkFile := range checkFiles {
+		checkResult, err := checkCheckFile(dir, checkFile, clause.Regexp, clause.Predicates)
+		result.Checks = append(result.Checks, checkResult)
+		if err != nil || checkResult.Outcome == "" {
+			return false, true, err
+		}
+		if checkPassed(checkResult.Outcome, clause.Regexp, false) { // the content of it matches
+			return !clause.Inverse, true, nil
+		}
+	}
+	return clause.Inverse, len(checkFiles) > 0, nil
+}
+
+// Check the check file (relative to the directory) against the regular expression and the predicates.
+// The outcome is empty if the context is done before the file is read.
+func checkCheckFile(dir *Candidate, checkFile string, checkRegexp *regexp.Regexp, predicates []ContentPredicate) (result CheckResult, err error) {
+	result.File = dir.Join(checkFile)
+	checkFileDirInfo, err := dir.fsys.Stat(result.File)
+	if err != nil {
+		// can't find or cannot read check file/dir
+		result.Outcome = CheckFileMissing
+		if errors.Is(err, fs.ErrPermission) {
+			return result, &PathError{PhaseReadCheckFile, result.File, err}
+		}
+		return result, nil
+	}
+	if checkFileDirInfo.IsDir() { // it is a directory
+		result.Outcome = CheckFileIsDirectory
+		return result, nil
+	}
+	if dir.ctx.Err() != nil { // no need to read the file
+		return result, nil
+	}
+	checkFileContent, err := dir.fsys.ReadFile(result.File)
+	if err != nil {
+		result.Outcome = CheckFileUnreadable
+		return result, &PathError{PhaseReadCheckFile, result.File, err}
+	}
+	switch {
+	case checkRegexp == nil:
+		result.Outcome = CheckFileMatched
+	case checkRegexp.NumSubexp() == 0:
+		result.Outcome = checkOutcome(checkRegexp.Match(checkFileContent))
+	default:
+		submatches := checkRegexp.FindSubmatch(checkFileContent)
+		result.Outcome = checkOutcome(submatches != nil)
+		if submatches != nil {
+			result.Captures = captures(checkRegexp, submatches)
+		}
+	}
+	if result.Outcome == CheckFileMatched {
+		for _, predicate := range predicates {
+			satisfied, err := predicate.Test(result.File, checkFileContent)
+			if err != nil {
+				return CheckResult{File: result.File, Outcome: CheckFileUnparsable},
+					&PathError{PhaseParseCheckFile, result.File, fmt.Errorf("parse %s: %w", result.File, err)}
+			}
+			if !satisfied {
+				return CheckResult{File: result.File, Outcome: CheckFileNotMatched}, nil
+			}
+		}
+	}
+	return result, nil
+}
+
+func checkOutcome(matched bool) CheckOutcome {
+	if matched {
+		return CheckFileMatched
+	}
+	return CheckFileNotMatched
+}
+
+// Pair the values captured by groups of the regular expression with names of the groups
+func captures(checkRegexp *regexp.Regexp, submatches [][]byte) []Capture {
+	result := make([]Capture, len(submatches)-1)
+	for i, name := range checkRegexp.SubexpNames()[1:] {
+		if name == "" {
+			name = strconv.Itoa(i + 1)
+		}
+		result[i] = Capture{name, string(submatches[i+1])}
+	}
+	return result
+}
+
+// Decide whether the check passes according to the outcome
+func checkPassed(outcome CheckOutcome, checkRegexp *regexp.Regexp, inverse bool) bool {
+	switch outcome {
+	case CheckFileMissing, CheckFileNotMatched:
+		return inverse
+	case CheckFileMatched:
+		return !inverse
+	case CheckFileIsDirectory:
+		// ".*" is the default matching all expression
+		return (checkRegexp == nil || checkRegexp.String() == ".*") != inverse
+	default:
+		return false
+	}
+}
+
+// Matcher requiring all of the matchers to match.
+// Matchers are evaluated in order, and the evaluation stops at the first one not matching.
+// It matches any directory if there is no matcher.
+func And(matchers ...Matcher) Matcher {
+	return MatcherFunc(func(dir *Candidate) (bool, error) {
+		for _, matcher := range matchers {
+			if matched, err := matcher.Match(dir); err != nil || !matched {
+				return false, err
+			}
+		}
+		return true, nil
+	})
+}
+
+// Matcher requiring any of the matchers to match.
+// Matchers are evaluated in order, and the evaluation stops at the first one matching.
+// It matches no directory if there is no matcher.
+func Or(matchers ...Matcher) Matcher {
+	return MatcherFunc(func(dir *Candidate) (bool, error) {
+		for _, matcher := range matchers {
+			if matched, err := matcher.Match(dir); err != nil || matched {
+				return matched, err
+			}
+		}
+		return false, nil
+	})
+}
+
+// Matcher requiring the matcher to not match.
+// If the matcher returns an error, the directory is regarded as not matching.
+func Not(matcher Matcher) Matcher {
+	return MatcherFunc(func(dir *Candidate) (bool, error) {
+		matched, err := matcher.Match(dir)
+		if err != nil {
+			return false, err
+		}
+		return !matched, nil
+	})
+}
@@ -0,0 +1,253 @@
+package lsh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"regexp"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gobwas/glob"
+	"github.com/stretchr/testify/assert"
+)
+
+var goModulesFS = fstest.MapFS{
+	"go.mod":                {Data: []byte("module github.com/example/root\n")},
+	"tools/lint/go.mod":     {Data: []byte("module github.com/example/tools/lint\n")},
+	"services/api/go.mod":   {Data: []byte("module github.com/other/api\n")},
+	"services/api/Makefile": {Data: []byte("build:\n")},
+	"services/web/Makefile": {Data: []byte("build:\n")},
+}
+
+// Matcher requiring go.mod to have a module path starting with the prefix
+func goModulePrefixMatcher(prefix string) Matcher {
+	return MatcherFunc(func(dir *Candidate) (bool, error) {
+		content, err := dir.ReadFile("go.mod")
+		if err != nil {
+			return false, nil
+		}
+		return bytes.HasPrefix(content, []byte("module "+prefix)), nil
+	})
+}
+
+func TestCustomMatcher(t *testing.T) {
+	options := fsOptionsForTesting()
+	options.Matcher = goModulePrefixMatcher("github.com/example/")
+	found, errs := LsHavingFS(goModulesFS, options, ".")
+	assert.Nil(t, errs)
+	assert.Equal(t, []string{".", "tools/lint"}, found)
+}
+
+func TestCustomMatcherCombinedWithDefaultMatcher(t *testing.T) {
+	options := fsOptionsForTesting("Makefile")
+	options.Matcher = And(DefaultMatcher(options), Not(goModulePrefixMatcher("github.com/example/")))
+	found, errs := LsHavingFS(goModulesFS, options, ".")
+	assert.Nil(t, errs)
+	assert.Equal(t, []string{"services/api", "services/web"}, found)
+}
+
+func TestMatcherCombinators(t *testing.T) {
+	hasGoMod := FlagFilesMatcher([]glob.Glob{glob.MustCompile("go.mod")}, false)
+	hasMakefile := FlagFilesMatcher([]glob.Glob{glob.MustCompile("Makefile")}, false)
+	isExample := CheckFileMatcher("go.mod", regexp.MustCompile(`github\.com/example/`), false)
+	for _, tc := range []struct {
+		matcher  Matcher
+		expected []string
+	}{
+		{And(hasGoMod, hasMakefile), []string{"services/api"}},
+		{Or(hasGoMod, hasMakefile), []string{".", "services/api", "services/web", "tools/lint"}},
+		{And(hasGoMod, Not(isExample)), []string{"services/api"}},
+		{Or(isExample, And(hasMakefile, Not(hasGoMod))), []string{".", "services/web", "tools/lint"}},
+		{And(), []string{".", "services", "services/api", "services/web", "tools", "tools/lint"}},
+		{Or(), []string{}},
+	} {
+		options := fsOptionsForTesting()
+		options.Matcher = tc.matcher
+		found, errs := LsHavingFS(goModulesFS, options, ".")
+		assert.Nil(t, errs)
+		assert.Equal(t, tc.expected, found)
+	}
+}
+
+func TestMatcherError(t *testing.T) {
+	options := fsOptionsForTesting()
+	options.Matcher = Or(goModulePrefixMatcher("github.com/other/"), MatcherFunc(func(dir *Candidate) (bool, error) {
+		if dir.Path == "tools/lint" {
+			return false, errors.New("failed")
+		}
+		return false, nil
+	}))
+	found, errs := LsHavingFS(goModulesFS, options, ".")
+	assert.Equal(t, []string{"services/api"}, found)
+	assert.Equal(t, []error{errors.New("failed")}, errs)
+
+	options.Matcher = Not(options.Matcher)
+	found, errs = LsHavingFS(goModulesFS, options, ".")
+	assert.Equal(t, []string{".", "services", "services/web", "tools"}, found)
+	assert.Equal(t, []error{errors.New("failed")}, errs)
+}
+
+func TestAbsentFiles(t *testing.T) {
+	options := fsOptionsForTesting("package.json", "build.gradle")
+	options.AbsentFiles = []glob.Glob{glob.MustCompile("tsconfig.json"), glob.MustCompile("*.yml")}
+	found, errs := LsHavingFS(mapFS, options, ".")
+	assert.Nil(t, errs)
+	assert.Equal(t, []string{".", "libs/shared"}, found)
+}
+
+var entryTypesFS = fstest.MapFS{
+	"file/src":           {Data: []byte("not a directory\n")},
+	"dir/src/main.go":    {Data: []byte("package main\n")},
+	"link/src":           {Data: []byte("dir/src"), Mode: fs.ModeSymlink},
+	"link/Makefile":      {Data: []byte("build:\n")},
+	"dir/Makefile/.keep": {},
+}
+
+func TestFlagFileTypes(t *testing.T) {
+	for _, tc := range []struct {
+		types    EntryType
+		expected []string
+	}{
+		{0, []string{"dir", "file", "link"}},
+		{EntryTypeFile, []string{"file"}},
+		{EntryTypeDir, []string{"dir"}},
+		{EntryTypeSymlink, []string{"link"}},
+		{EntryTypeFile | EntryTypeSymlink, []string{"file", "link"}},
+	} {
+		options := fsOptionsForTesting("src")
+		options.FlagFileTypes = tc.types
+		found, errs := LsHavingFS(entryTypesFS, options, ".")
+		assert.Nil(t, errs)
+		assert.Equal(t, tc.expected, found)
+	}
+
+	options := fsOptionsForTesting("src", "Makefile")
+	options.MatchAllFlagFiles = true
+	options.FlagFileTypes = EntryTypeFile | EntryTypeSymlink
+	found, errs := LsHavingFS(entryTypesFS, options, ".")
+	assert.Nil(t, errs)
+	assert.Equal(t, []string{"link"}, found)
+}
+
+var terraformFS = fstest.MapFS{
+	"main.tf":                   {Data: []byte("terraform {}\n")},
+	"variables.tf":              {Data: []byte("variable \"region\" {}\n")},
+	"outputs.tf":                {Data: []byte("output \"id\" {}\n")},
+	"modules/vpc/main.tf":       {Data: []byte("resource \"aws_vpc\" \"main\" {}\n")},
+	"scripts/stray.tf":          {Data: []byte("# not a module\n")},
+	"docker/Dockerfile":         {Data: []byte("FROM alpine\n")},
+	"docker/Dockerfile.dev":     {Data: []byte("FROM alpine\n")},
+	"web/Dockerfile":            {Data: []byte("FROM nginx\n")},
+	"web/package-lock.json":     {Data: []byte("{}\n")},
+	"web/yarn.lock":             {Data: []byte("\n")},
+	"modules/vpc/versions.tf":   {Data: []byte("terraform {}\n")},
+	"modules/vpc/Dockerfile.ci": {Data: []byte("FROM hashicorp/terraform\n")},
+}
+
+func TestFlagFileCount(t *testing.T) {
+	for _, tc := range []struct {
+		flagFiles []string
+		all       bool
+		min, max  int
+		expected  []string
+	}{
+		{[]string{"*.tf"}, false, 0, 0, []string{".", "modules/vpc", "scripts"}},
+		{[]string{"*.tf"}, false, 2, 0, []string{".", "modules/vpc"}},
+		{[]string{"*.tf"}, false, 3, 0, []string{"."}},
+		{[]string{"*.tf"}, false, 0, 2, []string{"modules/vpc", "scripts"}},
+		{[]string{"Dockerfile*"}, false, 1, 1, []string{"modules/vpc", "web"}},
+		{[]string{"{package-lock.json,yarn.lock,pnpm-lock.yaml}"}, false, 2, 0, []string{"web"}},
+		{[]string{"*.tf", "Dockerfile*"}, true, 2, 0, []string{}},
+		{[]string{"*.tf", "Dockerfile*"}, false, 2, 0, []string{".", "docker", "modules/vpc"}},
+	} {
+		options := fsOptionsForTesting(tc.flagFiles...)
+		options.MatchAllFlagFiles = tc.all
+		options.MinFlagFileCount = tc.min
+		options.MaxFlagFileCount = tc.max
+		found, errs := LsHavingFS(terraformFS, options, ".")
+		assert.Nil(t, errs)
+		assert.Equal(t, tc.expected, found, tc)
+	}
+
+	options := fsOptionsForTesting("*.tf", "Dockerfile*")
+	options.MaxFlagFileCount = 1
+	options.FS = terraformFS
+	found, errs := LsHavingResults(context.Background(), options, "modules/vpc")
+	assert.Nil(t, errs)
+	assert.Equal(t, 1, len(found))
+	assert.Equal(t, [][]string{nil, {"Dockerfile.ci"}}, found[0].FlagFiles)
+}
+
+func TestChecks(t *testing.T) {
+	options := fsOptionsForTesting("package.json")
+	options.Checks = []CheckClause{
+		{File: "package.json", Regexp: regexp.MustCompile(`"name": "(?:web|api)"`)},
+		{Glob: glob.MustCompile("*.{yml,json}", '/'), Regexp: regexp.MustCompile(`react|service`)},
+	}
+	options.FS = mapFS
+	found, errs := LsHavingResults(context.Background(), options, ".")
+	assert.Nil(t, errs)
+	assert.Equal(t, 2, len(found))
+	assert.Equal(t, "apps/api", found[0].Path)
+	assert.Equal(t, []CheckResult{
+		{File: "apps/api/package.json", Outcome: CheckFileMatched, Clause: 0},
+		{File: "apps/api/package.json", Outcome: CheckFileNotMatched, Clause: 1},
+		{File: "apps/api/serverless.yml", Outcome: CheckFileMatched, Clause: 1},
+	}, found[0].Checks)
+	assert.Equal(t, "apps/web", found[1].Path)
+
+	options.Checks[1].Inverse = true
+	found, errs = LsHavingResults(context.Background(), options, ".")
+	assert.Nil(t, errs)
+	assert.Equal(t, 0, len(found))
+
+	options.MatchAnyCheck = true
+	found, errs = LsHavingResults(context.Background(), options, ".")
+	assert.Nil(t, errs)
+	assert.Equal(t, 3, len(found))
+	assert.Equal(t, ".", found[0].Path)
+	assert.Equal(t, []CheckResult{
+		{File: "package.json", Outcome: CheckFileNotMatched, Clause: 0},
+		{File: "package.json", Outcome: CheckFileNotMatched, Clause: 1},
+	}, found[0].Checks)
+}
+
+func TestCheckCaptures(t *testing.T) {
+	options := fsOptionsForTesting("package.json")
+	options.CheckFile = "package.json"
+	options.CheckRegexp = regexp.MustCompile(`"name": "(?P<name>[^"]+)"(, "dependencies": \{"react": "([^"]+)"\})?`)
+	options.FS = mapFS
+	found, errs := LsHavingResults(context.Background(), options, "apps")
+	assert.Nil(t, errs)
+	assert.Equal(t, 2, len(found))
+	assert.Equal(t, []Capture{{"name", "api"}, {"2", ""}, {"3", ""}}, found[0].Checks[0].Captures)
+	assert.Equal(t, []Capture{{"name", "web"}, {"2", `, "dependencies": {"react": "^18.0.0"}`}, {"3", "^18.0.0"}}, found[1].Checks[0].Captures)
+}
+
+func TestDirNamesAndPathRegexp(t *testing.T) {
+	for _, tc := range []struct {
+		dirNames   []string
+		pathRegexp string
+		expected   []string
+	}{
+		{[]string{"api"}, "", []string{"apps/api"}},
+		{[]string{"a*", "w*"}, "", []string{"apps/api", "apps/web"}},
+		{[]string{"."}, "", []string{"."}},
+		{nil, `^apps/`, []string{"apps/api", "apps/web"}},
+		{[]string{"*"}, `/w`, []string{"apps/web"}},
+		{[]string{"shared"}, "", []string{}},
+	} {
+		options := fsOptionsForTesting("package.json")
+		for _, dirName := range tc.dirNames {
+			options.DirNames = append(options.DirNames, glob.MustCompile(dirName, '/'))
+		}
+		if tc.pathRegexp != "" {
+			options.PathRegexp = regexp.MustCompile(tc.pathRegexp)
+		}
+		found, errs := LsHavingFS(mapFS, options, ".")
+		assert.Nil(t, errs)
+		assert.Equal(t, tc.expected, found, tc)
+	}
+}
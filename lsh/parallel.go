@@ -0,0 +1,119 @@
+package lsh
+
+import (
+	"io/fs"
+	"sync"
+)
+
+// State shared by the goroutines looking into directories concurrently
+type parallelWalk struct {
+	mutex sync.Mutex
+
+	// Broadcasted when dirs, pending or stopped changes
+	cond *sync.Cond
+
+	// Directories waiting to be looked into
+	dirs []dirEntryEx
+
+	// Number of directories waiting to be looked into or being looked into
+	pending int
+
+	// True if no more directory should be looked into
+	stopped bool
+}
+
+// Look into the root directory and its subdirectories with a bounded number of goroutines.
+// The visit and report functions of the walker are wrapped so that they are called
+// by one goroutine at a time, and never called after the walk has been stopped.
+// fs.SkipAll is returned if no more directory should be looked into.
+func (w *walker) walkParallel(root *dirEntryEx, checkRoot bool) error {
+	p := &parallelWalk{}
+	p.cond = sync.NewCond(&p.mutex)
+
+	visit, report := w.visit, w.report
+	defer func() { w.visit, w.report = visit, report }()
+	w.visit = func(result *Result) error {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		if p.stopped {
+			return fs.SkipAll
+		}
+		err := visit(result)
+		if err != nil && err != fs.SkipDir {
+			if err != fs.SkipAll {
+				report(err)
+			}
+			p.stop()
+			return fs.SkipAll
+		}
+		return err
+	}
+	w.report = func(err error) bool {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		if p.stopped {
+			return false
+		}
+		if !report(err) || err == w.ctx.Err() {
+			p.stop()
+		}
+		return !p.stopped
+	}
+
+	p.pending = 1
+	subDirs, err := w.checkDir(root, checkRoot)
+	p.done(subDirs, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < w.options.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dir := p.take(); dir != nil; dir = p.take() {
+				subDirs, err := w.checkDir(dir, true)
+				p.done(subDirs, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if p.stopped {
+		return fs.SkipAll
+	}
+	return nil
+}
+
+// Wait for a directory to be looked into.
+// nil is returned if there's no more directory to be looked into.
+func (p *parallelWalk) take() *dirEntryEx {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for len(p.dirs) == 0 && p.pending > 0 && !p.stopped {
+		p.cond.Wait()
+	}
+	if p.stopped || len(p.dirs) == 0 {
+		return nil
+	}
+	dir := p.dirs[len(p.dirs)-1]
+	p.dirs = p.dirs[:len(p.dirs)-1]
+	return &dir
+}
+
+// Record that a directory has been looked into, and queue its subdirectories.
+func (p *parallelWalk) done(subDirs []dirEntryEx, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if err != nil {
+		p.stop()
+	} else {
+		p.dirs = append(p.dirs, subDirs...)
+		p.pending += len(subDirs)
+	}
+	p.pending--
+	p.cond.Broadcast()
+}
+
+// The caller must hold the mutex
+func (p *parallelWalk) stop() {
+	p.stopped = true
+	p.cond.Broadcast()
+}
@@ -0,0 +1,130 @@
+package lsh
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/gobwas/glob"
+)
+
+// Pattern of paths relative to a directory, such like "src/main/java", ".github/workflows/*.yml" or "**/*.tf".
+// Each segment of it is a glob matching names of entries,
+// except that "**" matches any number (including zero) of directories and ".." refers to the parent directory.
+type PathPattern struct {
+	// The pattern that it is compiled from
+	Pattern string
+
+	segments []glob.Glob // nil for "**", parentSegment for ".."
+}
+
+// The segment ".." in a PathPattern
+var parentSegment glob.Glob = parentGlob{}
+
+type parentGlob struct{}
+
+func (parentGlob) Match(string) bool {
+	return false
+}
+
+// Compile a pattern with segments separated by "/" or the separator.
+// "." segments are ignored, empty segments are not allowed, and the last segment can't be "**" or "..".
+func CompilePathPattern(pattern string, separator rune) (*PathPattern, error) {
+	p := &PathPattern{Pattern: pattern}
+	segments := strings.Split(strings.ReplaceAll(pattern, string(separator), "/"), "/")
+	for _, segment := range segments {
+		switch {
+		case segment == "":
+			return nil, fmt.Errorf("invalid path pattern %q: empty segment", pattern)
+		case segment == ".":
+			continue
+		case segment == "..":
+			p.segments = append(p.segments, parentSegment)
+		case segment == "**":
+			if len(p.segments) > 0 && p.segments[len(p.segments)-1] == nil {
+				continue // same as a single "**"
+			}
+			p.segments = append(p.segments, nil)
+		default:
+			g, err := glob.Compile(segment)
+			if err != nil {
+				return nil, fmt.Errorf("invalid path pattern %q: %w", pattern, err)
+			}
+			p.segments = append(p.segments, g)
+		}
+	}
+	if len(p.segments) == 0 || p.segments[len(p.segments)-1] == nil || p.segments[len(p.segments)-1] == parentSegment {
+		return nil, fmt.Errorf("invalid path pattern %q: it must end with a name or glob", pattern)
+	}
+	return p, nil
+}
+
+// Find paths (relative to the directory) of the entries matching the pattern and accepted by the filters.
+// Subdirectories excluded by Options.Excludes are not looked into.
+func (p *PathPattern) find(dir *Candidate, filters []EntryFilter) ([]string, error) {
+	var found []string
+	seen := make(map[string]emptyStruct) // "**" could lead to the same path more than once
+	err := p.findFrom(dir, "", dir.Entries, p.segments, filters, func(path string) {
+		if _, duplicated := seen[path]; !duplicated {
+			seen[path] = emptyVar
+			found = append(found, path)
+		}
+	})
+	return found, err
+}
+
+// Find entries matching the segments, starting from the subdirectory (relative to the directory) having the entries
+func (p *PathPattern) findFrom(dir *Candidate, subDir string, entries []fs.DirEntry, segments []glob.Glob, filters []EntryFilter, found func(path string)) error {
+	if dir.ctx.Err() != nil { // the caller would find it out
+		return nil
+	}
+	segment := segments[0]
+	if segment == parentSegment {
+		path := dir.fsys.Join(subDir, "..")
+		parentEntries, err := dir.fsys.ReadDir(dir.Join(path))
+		if err != nil {
+			if errors.Is(err, fs.ErrInvalid) || errors.Is(err, fs.ErrNotExist) { // such like above the root of an fs.FS
+				return nil
+			}
+			return &PathError{PhaseReadDir, dir.Join(path), err}
+		}
+		return p.findFrom(dir, path, parentEntries, segments[1:], filters, found)
+	}
+	if segment == nil { // "**"
+		if err := p.findFrom(dir, subDir, entries, segments[1:], filters, found); err != nil {
+			return err
+		}
+	}
+	for _, entry := range entries {
+		if segment != nil && !segment.Match(entry.Name()) {
+			continue
+		}
+		path := dir.fsys.Join(subDir, entry.Name())
+		if segment != nil && len(segments) == 1 {
+			accepted, err := acceptedByFilters(dir, path, entry, filters)
+			if err != nil {
+				return err
+			}
+			if accepted {
+				found(path)
+			}
+			continue
+		}
+		if !entry.IsDir() || len(dir.excludes) > 0 && anyGlobMatch(dir.excludes, dir.Join(path)) {
+			continue
+		}
+		subEntries, err := dir.fsys.ReadDir(dir.Join(path))
+		if err != nil {
+			return &PathError{PhaseReadDir, dir.Join(path), err}
+		}
+		next := segments[1:]
+		if segment == nil {
+			next = segments // "**" could match more directories
+		}
+		if err := p.findFrom(dir, path, subEntries, next, filters, found); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package lsh
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gobwas/glob"
+	"github.com/stretchr/testify/assert"
+)
+
+var nestedFS = fstest.MapFS{
+	"maven/pom.xml":                                  {Data: []byte("<project/>\n")},
+	"maven/src/main/java/App.java":                   {Data: []byte("class App {}\n")},
+	"maven/src/test/java/AppTest.java":               {Data: []byte("class AppTest {}\n")},
+	"node/package.json":                              {Data: []byte("{}\n")},
+	"node/.github/workflows/ci.yml":                  {Data: []byte("on: push\n")},
+	"node/.github/workflows/release.yaml":            {Data: []byte("on: release\n")},
+	"node/node_modules/lib/.github/workflows/ci.yml": {Data: []byte("on: push\n")},
+	"infra/modules/network/main.tf":                  {Data: []byte("resource \"aws_vpc\" \"main\" {}\n")},
+	"infra/src/main/java":                            {Data: []byte("not a directory\n")},
+}
+
+func TestCompilePathPattern(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		err     string
+	}{
+		{"src/main/java", ""},
+		{"./src/**/**/*.java", ""},
+		{`src\main\java`, ""},
+		{"/src", `invalid path pattern "/src": empty segment`},
+		{"src//java", `invalid path pattern "src//java": empty segment`},
+		{"src/**", `invalid path pattern "src/**": it must end with a name or glob`},
+		{".", `invalid path pattern ".": it must end with a name or glob`},
+		{"src/[main", `invalid path pattern "src/[main": unexpected end of input`},
+	} {
+		_, err := CompilePathPattern(tc.pattern, '\\')
+		if tc.err == "" {
+			assert.Nil(t, err, tc.pattern)
+		} else {
+			assert.EqualError(t, err, tc.err)
+		}
+	}
+}
+
+func TestFlagPaths(t *testing.T) {
+	for _, tc := range []struct {
+		patterns []string
+		all      bool
+		types    EntryType
+		expected []string
+	}{
+		{[]string{"src/main/java"}, false, 0, []string{"infra", "maven"}},
+		{[]string{"src/main/java"}, false, EntryTypeDir, []string{"maven"}},
+		{[]string{".github/workflows/*.{yml,yaml}"}, false, 0, []string{"node"}},
+		{[]string{"**/*.tf"}, false, 0, []string{".", "infra", "infra/modules", "infra/modules/network"}},
+		{[]string{"**/ci.yml"}, false, 0, []string{".", "node", "node/.github", "node/.github/workflows"}},
+		{[]string{"src/*/java", "**/*.tf"}, true, 0, []string{"infra"}},
+	} {
+		options := fsOptionsForTesting()
+		for _, pattern := range tc.patterns {
+			p, err := CompilePathPattern(pattern, '/')
+			assert.Nil(t, err)
+			options.FlagPaths = append(options.FlagPaths, p)
+		}
+		options.MatchAllFlagFiles = tc.all
+		options.FlagFileTypes = tc.types
+		found, errs := LsHavingFS(nestedFS, options, ".")
+		assert.Nil(t, errs)
+		assert.Equal(t, tc.expected, found, tc.patterns)
+	}
+}
+
+func TestFlagPathsResults(t *testing.T) {
+	options := fsOptionsForTesting("pom.xml")
+	pattern, _ := CompilePathPattern("src/**/*.java", '/')
+	options.FlagPaths = []*PathPattern{pattern}
+	options.MatchAllFlagFiles = true
+	options.FS = nestedFS
+	found, errs := LsHavingResults(context.Background(), options, ".")
+	assert.Nil(t, errs)
+	assert.Equal(t, 1, len(found))
+	assert.Equal(t, "maven", found[0].Path)
+	assert.Equal(t, [][]string{{"pom.xml"}, {"src/main/java/App.java", "src/test/java/AppTest.java"}}, found[0].FlagFiles)
+}
+
+func TestCheckPathPattern(t *testing.T) {
+	options := fsOptionsForTesting("package.json")
+	pattern, _ := CompilePathPattern(".github/workflows/*", '/')
+	options.Checks = []CheckClause{{Glob: glob.MustCompile("*"), Pattern: pattern, Regexp: regexp.MustCompile("release")}}
+	options.FS = nestedFS
+	found, errs := LsHavingResults(context.Background(), options, ".")
+	assert.Nil(t, errs)
+	assert.Equal(t, 1, len(found))
+	assert.Equal(t, []CheckResult{
+		{File: "node/.github/workflows/ci.yml", Outcome: CheckFileNotMatched},
+		{File: "node/.github/workflows/release.yaml", Outcome: CheckFileMatched},
+	}, found[0].Checks)
+}
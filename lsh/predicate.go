@@ -0,0 +1,249 @@
+package lsh
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Condition on the content of a check file, in addition to the regular expression
+type ContentPredicate interface {
+	// Check whether the content of the file satisfies the condition.
+	// The file is the path of the check file.
+	// An error should be returned if the content can't be parsed.
+	Test(file string, content []byte) (bool, error)
+}
+
+// Condition on the value at a path in a JSON, YAML or TOML document.
+// The format of the document is decided by the extension of the check file:
+// ".yaml" and ".yml" for YAML, ".toml" for TOML, and JSON for anything else.
+type PathPredicate struct {
+	// The expression that the predicate is parsed from
+	Expression string
+
+	steps      []pathStep
+	comparison valueComparison
+}
+
+// A key in an object, or an index in an array
+type pathStep struct {
+	key   string
+	index int // -1 if it is a key
+}
+
+// Parse an expression into a PathPredicate.
+//
+// The expression is a path optionally followed by an operator and a value:
+//
+//	.scripts.test               the value exists (it could be null)
+//	.engines.node == 18         the value in text equals to the value specified
+//	.engines.node != 18         the value exists, and in text it does not equal to the value specified
+//	.engines.node =~ ^18        the value in text matches the regular expression
+//	.engines.node !~ ^18        the value exists, and in text it does not match the regular expression
+//
+// In the path, ".name" selects a key in an object, "[0]" selects an element in an array,
+// and ["name"] selects a key containing special characters, such like .dependencies["@types/node"].
+// A path consisting of just "." selects the whole document.
+// The value could be quoted with double quotes, otherwise spaces around it are trimmed.
+// Strings are compared as is, numbers and booleans are compared in their text form, and null is "null".
+func ParsePathPredicate(expression string) (*PathPredicate, error) {
+	p := &PathPredicate{Expression: expression}
+	rest := strings.TrimSpace(expression)
+	if !strings.HasPrefix(rest, ".") && !strings.HasPrefix(rest, "[") {
+		return nil, fmt.Errorf("invalid path expression %q: path must start with \".\" or \"[\"", expression)
+	}
+	if strings.HasPrefix(rest, ".") && (len(rest) == 1 || !isPathKeyChar(rest[1])) {
+		rest = rest[1:] // the whole document
+	}
+	for len(rest) > 0 && (rest[0] == '.' || rest[0] == '[') {
+		var step pathStep
+		var err error
+		step, rest, err = parsePathStep(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path expression %q: %w", expression, err)
+		}
+		p.steps = append(p.steps, step)
+	}
+
+	comparison, err := parseValueComparison(rest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path expression %q: %w", expression, err)
+	}
+	p.comparison = comparison
+	return p, nil
+}
+
+// Parse a step in the path, returning the step and the remaining part of the path
+func parsePathStep(s string) (pathStep, string, error) {
+	if s[0] == '.' {
+		end := 1
+		for end < len(s) && isPathKeyChar(s[end]) {
+			end++
+		}
+		if end == 1 {
+			return pathStep{}, s, fmt.Errorf("expecting a key after \".\"")
+		}
+		return pathStep{key: s[1:end], index: -1}, s[end:], nil
+	}
+	end := strings.IndexByte(s, ']')
+	if strings.HasPrefix(s, `["`) { // the key could contain "]"
+		end = strings.Index(s, `"]`)
+		if end >= 0 {
+			end++
+		}
+	}
+	if end < 0 {
+		return pathStep{}, s, fmt.Errorf("missing \"]\"")
+	}
+	inside := s[1:end]
+	if strings.HasPrefix(inside, `"`) {
+		key, err := strconv.Unquote(inside)
+		if err != nil {
+			return pathStep{}, s, fmt.Errorf("invalid quoted key %s", inside)
+		}
+		return pathStep{key: key, index: -1}, s[end+1:], nil
+	}
+	index, err := strconv.Atoi(inside)
+	if err != nil || index < 0 {
+		return pathStep{}, s, fmt.Errorf("invalid index %q", inside)
+	}
+	return pathStep{index: index}, s[end+1:], nil
+}
+
+func isPathKeyChar(c byte) bool {
+	return c == '_' || c == '-' || c == '$' || c == '@' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func (p *PathPredicate) Test(file string, content []byte) (bool, error) {
+	document, err := parseDocument(file, content)
+	if err != nil {
+		return false, err
+	}
+	value, found := p.lookup(document)
+	return found && p.comparison.test(valueText(value)), nil
+}
+
+// Find the value at the path in the document
+func (p *PathPredicate) lookup(document any) (any, bool) {
+	value := document
+	for _, step := range p.steps {
+		v := reflect.ValueOf(value)
+		switch {
+		case step.index < 0 && v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+			element := v.MapIndex(reflect.ValueOf(step.key).Convert(v.Type().Key()))
+			if !element.IsValid() {
+				return nil, false
+			}
+			value = element.Interface()
+		case step.index >= 0 && (v.Kind() == reflect.Slice || v.Kind() == reflect.Array):
+			if step.index >= v.Len() {
+				return nil, false
+			}
+			value = v.Index(step.index).Interface()
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// Parse the content of the file as JSON, YAML or TOML according to the extension of the file
+func parseDocument(file string, content []byte) (document any, err error) {
+	switch strings.ToLower(path.Ext(file)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &document)
+	case ".toml":
+		var table map[string]any
+		err = toml.Unmarshal(content, &table)
+		document = table
+	default:
+		if len(bytes.TrimSpace(content)) == 0 { // regarded as null, like an empty YAML document
+			return nil, nil
+		}
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.UseNumber() // to keep numbers in their original text form
+		err = decoder.Decode(&document)
+	}
+	return
+}
+
+// Text form of the value for comparison
+func valueText(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return v
+	case map[string]any, []any, []map[string]any:
+		text, _ := json.Marshal(v)
+		return string(text)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Comparison between a value found and the value specified, shared by predicates
+type valueComparison struct {
+	operator string // empty for checking existence only
+	value    string
+	regexp   *regexp.Regexp
+}
+
+// Parse what follows the path or the key in an expression, which is either empty
+// or an operator (==, !=, =~ or !~) followed by a value that could be quoted with double quotes
+func parseValueComparison(s string) (valueComparison, error) {
+	var c valueComparison
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return c, nil
+	}
+	for _, operator := range []string{"==", "!=", "=~", "!~"} {
+		if strings.HasPrefix(s, operator) {
+			c.operator = operator
+			break
+		}
+	}
+	if c.operator == "" {
+		return c, fmt.Errorf("expecting ==, !=, =~ or !~ but found %q", s)
+	}
+	c.value = strings.TrimSpace(s[len(c.operator):])
+	if strings.HasPrefix(c.value, `"`) {
+		value, err := strconv.Unquote(c.value)
+		if err != nil {
+			return c, fmt.Errorf("invalid quoted value %s", c.value)
+		}
+		c.value = value
+	}
+	if c.operator == "=~" || c.operator == "!~" {
+		re, err := regexp.Compile(c.value)
+		if err != nil {
+			return c, err
+		}
+		c.regexp = re
+	}
+	return c, nil
+}
+
+// Check whether the value found satisfies the comparison
+func (c *valueComparison) test(text string) bool {
+	switch c.operator {
+	case "==":
+		return text == c.value
+	case "!=":
+		return text != c.value
+	case "=~":
+		return c.regexp.MatchString(text)
+	case "!~":
+		return !c.regexp.MatchString(text)
+	default:
+		return true
+	}
+}
@@ -0,0 +1,81 @@
+package lsh
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gobwas/glob"
+	"github.com/stretchr/testify/assert"
+)
+
+var configFS = fstest.MapFS{
+	"json/package.json":   {Data: []byte(`{"name": "json", "engines": {"node": ">=18"}, "files": ["dist", "lib"], "private": true, "version": 2}`)},
+	"yaml/config.yml":     {Data: []byte("name: yaml\nengines:\n  node: 16.x\nfiles:\n  - src\nprivate: false\n")},
+	"toml/config.toml":    {Data: []byte("name = \"toml\"\nfiles = [\"dist\"]\n\n[engines]\nnode = \"18\"\n\n[[bin]]\nname = \"cli\"\n")},
+	"invalid/config.json": {Data: []byte(`{"name": `)},
+	"empty/config.json":   {Data: []byte(``)},
+}
+
+func TestPathPredicate(t *testing.T) {
+	for _, tc := range []struct {
+		expression string
+		expected   []string
+	}{
+		{`.name`, []string{"json", "toml", "yaml"}},
+		{`.`, []string{"empty", "json", "toml", "yaml"}},
+		{`.engines.node`, []string{"json", "toml", "yaml"}},
+		{`.engines.node =~ 18`, []string{"json", "toml"}},
+		{`.engines.node !~ 18`, []string{"yaml"}},
+		{`.engines.node == ">=18"`, []string{"json"}},
+		{`.engines.node != 18`, []string{"json", "yaml"}},
+		{`.files[1]`, []string{"json"}},
+		{`.files[0] == dist`, []string{"json", "toml"}},
+		{`.["files"][0]==src`, []string{"yaml"}},
+		{`.bin[0].name == cli`, []string{"toml"}},
+		{`.private == true`, []string{"json"}},
+		{`.version == 2`, []string{"json"}},
+		{`.name.first`, []string{}},
+		{`.files.name`, []string{}},
+	} {
+		predicate, err := ParsePathPredicate(tc.expression)
+		assert.Nil(t, err)
+		options := fsOptionsForTesting("*")
+		options.Checks = []CheckClause{{Glob: glob.MustCompile("*.{json,yml,toml}", '/'), Predicates: []ContentPredicate{predicate}}}
+		found, errs := LsHavingFS(configFS, options, ".")
+		assert.Equal(t, tc.expected, found, tc.expression)
+		assert.Equal(t, 1, len(errs), tc.expression)
+	}
+}
+
+func TestPathPredicateParseError(t *testing.T) {
+	predicate, _ := ParsePathPredicate(".name")
+	options := fsOptionsForTesting("*")
+	options.Checks = []CheckClause{{File: "config.json", Predicates: []ContentPredicate{predicate}}}
+	options.FS = configFS
+	found, errs := LsHavingResults(context.Background(), options, "invalid")
+	assert.Equal(t, 0, len(found))
+	assert.Equal(t, 1, len(errs))
+	var pathError *PathError
+	assert.True(t, errors.As(errs[0], &pathError))
+	assert.Equal(t, PhaseParseCheckFile, pathError.Phase)
+	assert.Equal(t, "invalid/config.json", pathError.Path)
+}
+
+func TestParsePathPredicateError(t *testing.T) {
+	for _, tc := range []struct {
+		expression string
+		err        string
+	}{
+		{`name`, `invalid path expression "name": path must start with "." or "["`},
+		{`.a..b`, `invalid path expression ".a..b": expecting a key after "."`},
+		{`.a[0`, `invalid path expression ".a[0": missing "]"`},
+		{`.a[x]`, `invalid path expression ".a[x]": invalid index "x"`},
+		{`.a = 1`, `invalid path expression ".a = 1": expecting ==, !=, =~ or !~ but found "= 1"`},
+		{`.a == "1`, `invalid path expression ".a == \"1": invalid quoted value "1`},
+	} {
+		_, err := ParsePathPredicate(tc.expression)
+		assert.EqualError(t, err, tc.err)
+	}
+}
@@ -0,0 +1,339 @@
+package lsh
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/gobwas/glob"
+)
+
+// Parse a query expression into a Matcher.
+//
+// A query expression combines conditions with "&&" (and), "||" (or), "!" (not) and parentheses.
+// "!" binds tighter than "&&", which binds tighter than "||".
+// Conditions are function calls taking string ("...") or regular expression (/.../) arguments:
+//
+//	has("glob")                 the directory has an entry with name matching the glob
+//	exists("path")              the file or directory exists, the path is relative to the directory
+//	contains("path", /regexp/)  the content of the file matches the regular expression
+//	contains("path", "text")    the content of the file contains the text
+//
+// In strings, backslash escapes the next character.
+// In regular expressions, "\/" stands for "/", and flags (i, m, s, U) can follow the closing "/", such like /jest/i.
+// Globs are compiled with the separator specified.
+//
+// For example:
+//
+//	has("package.json") && !has("tsconfig.json") && contains("package.json", /"jest"/)
+func ParseQuery(query string, separator rune) (Matcher, error) {
+	p := queryParser{input: query, separator: separator}
+	p.next()
+	matcher, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.token.kind != tokenEnd {
+		return nil, p.errorf("unexpected %s", p.token)
+	}
+	return matcher, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenRegexp
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenLeftParen
+	tokenRightParen
+	tokenComma
+	tokenInvalid
+)
+
+type queryToken struct {
+	kind tokenKind
+	text string // identifier, unescaped string, regular expression, or the invalid input
+	pos  int    // position in the query, starting from 0
+}
+
+func (t queryToken) String() string {
+	switch t.kind {
+	case tokenEnd:
+		return "end of expression"
+	case tokenString:
+		return fmt.Sprintf("string %q", t.text)
+	case tokenRegexp:
+		return fmt.Sprintf("regular expression /%s/", t.text)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+type queryParser struct {
+	input     string
+	separator rune
+	pos       int
+	token     queryToken // current token
+}
+
+func (p *queryParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("invalid query at position %d: %s", p.token.pos+1, fmt.Sprintf(format, args...))
+}
+
+// Read the next token into p.token
+func (p *queryParser) next() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.input) {
+		p.token = queryToken{tokenEnd, "", start}
+		return
+	}
+
+	rest := p.input[p.pos:]
+	switch {
+	case strings.HasPrefix(rest, "&&"):
+		p.pos += 2
+		p.token = queryToken{tokenAnd, "&&", start}
+	case strings.HasPrefix(rest, "||"):
+		p.pos += 2
+		p.token = queryToken{tokenOr, "||", start}
+	case rest[0] == '!':
+		p.pos++
+		p.token = queryToken{tokenNot, "!", start}
+	case rest[0] == '(':
+		p.pos++
+		p.token = queryToken{tokenLeftParen, "(", start}
+	case rest[0] == ')':
+		p.pos++
+		p.token = queryToken{tokenRightParen, ")", start}
+	case rest[0] == ',':
+		p.pos++
+		p.token = queryToken{tokenComma, ",", start}
+	case rest[0] == '"':
+		p.token = p.readQuoted('"', tokenString, func(b *strings.Builder, c byte) { b.WriteByte(c) })
+	case rest[0] == '/':
+		p.token = p.readQuoted('/', tokenRegexp, func(b *strings.Builder, c byte) {
+			if c != '/' { // "\/" stands for "/", other escapes are kept for the regular expression
+				b.WriteByte('\\')
+			}
+			b.WriteByte(c)
+		})
+		end := p.pos
+		for p.pos < len(p.input) && strings.IndexByte("imsU", p.input[p.pos]) >= 0 {
+			p.pos++
+		}
+		if flags := p.input[end:p.pos]; flags != "" && p.token.kind == tokenRegexp {
+			p.token.text = "(?" + flags + ")" + p.token.text
+		}
+	case isIdentChar(rest[0]):
+		for p.pos < len(p.input) && isIdentChar(p.input[p.pos]) {
+			p.pos++
+		}
+		p.token = queryToken{tokenIdent, p.input[start:p.pos], start}
+	default:
+		p.pos++
+		p.token = queryToken{tokenInvalid, rest[:1], start}
+	}
+}
+
+// Read a string or a regular expression enclosed by the quote character.
+// The escape function is called for each character following a backslash.
+func (p *queryParser) readQuoted(quote byte, kind tokenKind, escape func(b *strings.Builder, c byte)) queryToken {
+	start := p.pos
+	var b strings.Builder
+	for p.pos++; p.pos < len(p.input); p.pos++ {
+		c := p.input[p.pos]
+		switch {
+		case c == quote:
+			p.pos++
+			return queryToken{kind, b.String(), start}
+		case c == '\\' && p.pos+1 < len(p.input):
+			p.pos++
+			escape(&b, p.input[p.pos])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return queryToken{tokenInvalid, p.input[start:], start}
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// or := and ("||" and)*
+func (p *queryParser) parseOr() (Matcher, error) {
+	matchers, err := p.parseList(tokenOr, p.parseAnd)
+	if err != nil {
+		return nil, err
+	}
+	if len(matchers) == 1 {
+		return matchers[0], nil
+	}
+	return Or(matchers...), nil
+}
+
+// and := unary ("&&" unary)*
+func (p *queryParser) parseAnd() (Matcher, error) {
+	matchers, err := p.parseList(tokenAnd, p.parseUnary)
+	if err != nil {
+		return nil, err
+	}
+	if len(matchers) == 1 {
+		return matchers[0], nil
+	}
+	return And(matchers...), nil
+}
+
+// Parse operands separated by the operator
+func (p *queryParser) parseList(operator tokenKind, parseOperand func() (Matcher, error)) ([]Matcher, error) {
+	var matchers []Matcher
+	for {
+		matcher, err := parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, matcher)
+		if p.token.kind != operator {
+			return matchers, nil
+		}
+		p.next()
+	}
+}
+
+// unary := "!" unary | "(" or ")" | call
+func (p *queryParser) parseUnary() (Matcher, error) {
+	switch p.token.kind {
+	case tokenNot:
+		p.next()
+		matcher, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not(matcher), nil
+	case tokenLeftParen:
+		p.next()
+		matcher, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.token.kind != tokenRightParen {
+			return nil, p.errorf("expecting \")\" but found %s", p.token)
+		}
+		p.next()
+		return matcher, nil
+	case tokenIdent:
+		return p.parseCall()
+	default:
+		return nil, p.errorf("expecting a condition but found %s", p.token)
+	}
+}
+
+// call := ident "(" argument ("," argument)* ")"
+func (p *queryParser) parseCall() (Matcher, error) {
+	name := p.token
+	p.next()
+	if p.token.kind != tokenLeftParen {
+		return nil, p.errorf("expecting \"(\" after %s but found %s", name, p.token)
+	}
+	p.next()
+	var args []queryToken
+	for {
+		if p.token.kind != tokenString && p.token.kind != tokenRegexp {
+			return nil, p.errorf("expecting a string or a regular expression but found %s", p.token)
+		}
+		args = append(args, p.token)
+		p.next()
+		if p.token.kind == tokenRightParen {
+			p.next()
+			break
+		}
+		if p.token.kind != tokenComma {
+			return nil, p.errorf("expecting \",\" or \")\" but found %s", p.token)
+		}
+		p.next()
+	}
+
+	condition, found := queryConditions[name.text]
+	if !found {
+		p.token = name
+		return nil, p.errorf("unknown condition %s", name)
+	}
+	if len(args) != len(condition.args) {
+		p.token = name
+		return nil, p.errorf("%s expects %d argument(s) but got %d", name, len(condition.args), len(args))
+	}
+	for i, arg := range args {
+		if arg.kind == tokenRegexp && condition.args[i] != tokenRegexp {
+			p.token = arg
+			return nil, p.errorf("%s can't be used as argument %d of %s", arg, i+1, name)
+		}
+	}
+	matcher, err := condition.build(args, p.separator)
+	if err != nil {
+		p.token = name
+		return nil, p.errorf("%s", err)
+	}
+	return matcher, nil
+}
+
+// A condition that can be used in query expressions
+type queryCondition struct {
+	// Kinds of the arguments, tokenRegexp means either a string or a regular expression
+	args  []tokenKind
+	build func(args []queryToken, separator rune) (Matcher, error)
+}
+
+var queryConditions = map[string]queryCondition{
+	"has": {[]tokenKind{tokenString}, func(args []queryToken, separator rune) (Matcher, error) {
+		g, err := glob.Compile(args[0].text, separator)
+		if err != nil {
+			return nil, err
+		}
+		globs := []glob.Glob{g}
+		return MatcherFunc(func(dir *Candidate) (bool, error) {
+			flagFiles, err := findFlagFiles(dir, globs, nil)
+			return err == nil && flagFilesFound(flagFiles, false), err
+		}), nil
+	}},
+	"exists": {[]tokenKind{tokenString}, func(args []queryToken, separator rune) (Matcher, error) {
+		name := args[0].text
+		return MatcherFunc(func(dir *Candidate) (bool, error) {
+			_, err := dir.Stat(name)
+			if err != nil && errors.Is(err, fs.ErrPermission) {
+				return false, &PathError{PhaseReadCheckFile, dir.Join(name), err}
+			}
+			return err == nil, nil
+		}), nil
+	}},
+	"contains": {[]tokenKind{tokenString, tokenRegexp}, func(args []queryToken, separator rune) (Matcher, error) {
+		expression := args[1].text
+		if args[1].kind == tokenString {
+			expression = regexp.QuoteMeta(expression)
+		}
+		checkRegexp, err := regexp.Compile(expression)
+		if err != nil {
+			return nil, err
+		}
+		return queryCheckFileMatcher(args[0].text, checkRegexp), nil
+	}},
+}
+
+// Like CheckFileMatcher, but nothing is recorded in the Result,
+// and the file must exist and its content must match.
+func queryCheckFileMatcher(checkFile string, checkRegexp *regexp.Regexp) Matcher {
+	return MatcherFunc(func(dir *Candidate) (bool, error) {
+		checkResult, err := checkCheckFile(dir, checkFile, checkRegexp, nil)
+		return checkResult.Outcome == CheckFileMatched, err
+	})
+}
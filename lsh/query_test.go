@@ -0,0 +1,65 @@
+package lsh
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQuery(t *testing.T) {
+	for _, tc := range []struct {
+		query    string
+		expected []string
+	}{
+		{`has("package.json")`, []string{".", "apps/api", "apps/web"}},
+		{`has("package.json") && !has("tsconfig.json")`, []string{".", "apps/api"}},
+		{`has("package.json")&&!has("tsconfig.json")&&!exists("serverless.yml")`, []string{"."}},
+		{`has("build.gradle") || has("serverless.*")`, []string{"apps/api", "libs/shared"}},
+		{`has("build.gradle") || has("package.json") && has("*.yml")`, []string{"apps/api", "libs/shared"}},
+		{`(has("build.gradle") || has("package.json")) && !has("*.yml")`, []string{".", "apps/web", "libs/shared"}},
+		{`!!has("tsconfig.json")`, []string{"apps/web"}},
+		{`contains("package.json", /"react"/)`, []string{"apps/web"}},
+		{`contains("package.json", /"REACT"/i)`, []string{"apps/web"}},
+		{`contains("package.json", "\"name\": \"api\"")`, []string{"apps/api"}},
+		{`contains("package.json", "react") || contains("build.gradle", /apply\s+plugin/)`, []string{"apps/web", "libs/shared"}},
+		{`contains("src/main/java/Shared.java", /class\s/)`, []string{"libs/shared"}},
+		{`exists("src/main/java") && !contains("src", /.*/)`, []string{"libs/shared"}},
+		{`has("*.json") && !contains("package.json", /^\{"name": "(root|web)"/)`, []string{"apps/api"}},
+		{`exists("../web/tsconfig.json")`, []string{"apps/api", "apps/web"}},
+	} {
+		matcher, err := ParseQuery(tc.query, '/')
+		assert.Nil(t, err, tc.query)
+		options := fsOptionsForTesting()
+		options.Matcher = matcher
+		found, errs := LsHavingFS(mapFS, options, ".")
+		assert.Nil(t, errs, tc.query)
+		assert.Equal(t, tc.expected, found, tc.query)
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+		error string
+	}{
+		{``, `invalid query at position 1: expecting a condition but found end of expression`},
+		{`has("a") &&`, `invalid query at position 12: expecting a condition but found end of expression`},
+		{`has("a") has("b")`, `invalid query at position 10: unexpected "has"`},
+		{`has("a" || has("b")`, `invalid query at position 9: expecting "," or ")" but found "||"`},
+		{`(has("a")`, `invalid query at position 10: expecting ")" but found end of expression`},
+		{`has "a"`, `invalid query at position 5: expecting "(" after "has" but found string "a"`},
+		{`has()`, `invalid query at position 5: expecting a string or a regular expression but found ")"`},
+		{`has("a", "b")`, `invalid query at position 1: "has" expects 1 argument(s) but got 2`},
+		{`has(/a/)`, `invalid query at position 5: regular expression /a/ can't be used as argument 1 of "has"`},
+		{`unknown("a")`, `invalid query at position 1: unknown condition "unknown"`},
+		{`contains("a", /[/)`, "invalid query at position 1: error parsing regexp: missing closing ]: `[`"},
+		{`has("a) && has("b")`, `invalid query at position 17: expecting "," or ")" but found "b"`},
+		{`has("a") & has("b")`, `invalid query at position 10: unexpected "&"`},
+		{`has("[a")`, `invalid query at position 1: unexpected end of input`},
+	} {
+		_, err := ParseQuery(tc.query, '/')
+		if assert.NotNil(t, err, tc.query) {
+			assert.Equal(t, tc.error, err.Error(), tc.query)
+		}
+	}
+}
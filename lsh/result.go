@@ -0,0 +1,118 @@
+package lsh
+
+import (
+	"context"
+	"sort"
+)
+
+// Details of a directory found, telling why it matches conditions
+type Result struct {
+	// The root directory (as it was passed in) that the directory was found under
+	Root string
+
+	// Path of the directory
+	Path string
+
+	// Depth of the directory, the root directory has depth 0
+	Depth int
+
+	// For each of the globs in Options.FlagFiles, followed by each of the patterns in Options.FlagPaths,
+	// followed by each of the templates in Options.FlagFileTemplates (in the same order),
+	// names of the entries in the directory (or paths relative to the directory, for path patterns) matching it.
+	// The array for a glob or a pattern is nil if there is no entry matching it,
+	// or if the number of entries matching it is out of the range specified by Options.MinFlagFileCount and Options.MaxFlagFileCount.
+	FlagFiles [][]string
+
+	// Check files checked, in the order of being checked.
+	// Check files not needed for deciding whether the directory matches are not checked.
+	Checks []CheckResult
+
+	// Dependencies satisfying Options.DependsOn
+	Dependencies []Dependency
+}
+
+// Outcome of checking a check file
+type CheckResult struct {
+	// Path of the check file
+	File string
+
+	// Outcome of checking the check file
+	Outcome CheckOutcome
+
+	// Values captured by groups in the regular expression, if the content of the check file matches it.
+	// It is nil if there is no group in the regular expression.
+	Captures []Capture
+
+	// Index of the clause in Options.Checks that the check file is checked for,
+	// or -1 if it is checked for Options.CheckFile or by a matcher created by CheckClauseMatcher
+	Clause int
+}
+
+// Value captured by a group in the regular expression used for checking the check file
+type Capture struct {
+	// Name of the group, or the index (starting from 1) of the group if it is not named
+	Name string
+
+	// Text captured, or empty if the group does not participate in the match
+	Value string
+}
+
+// Outcome of checking the check file.
+// Whether the directory matches conditions also depends on whether the checking is inverse.
+type CheckOutcome string
+
+const (
+	// The check file does not exist or can't be accessed
+	CheckFileMissing CheckOutcome = "missing"
+
+	// The check file is a directory, its content is not checked
+	CheckFileIsDirectory CheckOutcome = "directory"
+
+	// The check file exists but can't be read
+	CheckFileUnreadable CheckOutcome = "unreadable"
+
+	// The content of the check file can't be parsed for evaluating predicates
+	CheckFileUnparsable CheckOutcome = "unparsable"
+
+	// The content of the check file matches the regular expression (and satisfies the predicates)
+	CheckFileMatched CheckOutcome = "matched"
+
+	// The content of the check file does not match the regular expression (or does not satisfy the predicates)
+	CheckFileNotMatched CheckOutcome = "not-matched"
+)
+
+// Function to be called for each of the directories found by LsHavingResultsFunc.
+//
+// The returned value is handled in the same way as the one returned by VisitFunc.
+type ResultFunc func(result *Result) error
+
+// Find directories matching conditions, and return the details of them.
+//
+// It works in the same way as LsHavingContext,
+// except that details of the directories are returned instead of just paths.
+// The array returned is sorted by path in ascend order.
+func LsHavingResults(ctx context.Context, options *Options, rootDirs ...string) (found []*Result, errors []error) {
+	found = make([]*Result, 0, 100)
+
+	errors = LsHavingResultsFunc(ctx, options, func(result *Result) error {
+		found = append(found, result)
+		return nil
+	}, rootDirs...)
+
+	sort.Slice(found, func(i, j int) bool { return found[i].Path < found[j].Path })
+	return
+}
+
+// Find directories matching conditions, and call the visit function with the details of each of them
+// as soon as it is found.
+//
+// It works in the same way as LsHavingFuncContext,
+// except that details of the directories are passed to the visit function instead of just paths.
+func LsHavingResultsFunc(ctx context.Context, options *Options, visit ResultFunc, rootDirs ...string) (errors []error) {
+	w := newWalker(ctx, options, visit, func(err error) bool {
+		errors = append(errors, err)
+		return !options.PanicOnError
+	})
+	w.walk(rootDirs)
+	return
+}
@@ -0,0 +1,103 @@
+package lsh
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gobwas/glob"
+)
+
+// Placeholders that can be used in a PatternTemplate
+const (
+	// Replaced by the name (see Candidate.Name) of the directory
+	PlaceholderDirName = "{dirname}"
+	// Replaced by the name of the parent directory of the directory
+	PlaceholderParent = "{parent}"
+)
+
+// Name, glob or path pattern containing placeholders, such like "{dirname}.csproj" or "../{dirname}.md".
+// It is expanded for each of the directories by replacing the placeholders with names of the directory and its parent,
+// and the result is then used as a glob or, if it contains separators, as a PathPattern.
+// Names replacing the placeholders are matched literally, even if they contain characters like "*" or "[".
+type PatternTemplate struct {
+	// The pattern that it is compiled from
+	Pattern string
+
+	separator rune
+	literal   bool // no glob meta character except for those in the placeholders
+}
+
+// Check whether the string contains any placeholder
+func HasPlaceholders(s string) bool {
+	return strings.Contains(s, PlaceholderDirName) || strings.Contains(s, PlaceholderParent)
+}
+
+// Compile a pattern containing placeholders, with segments separated by "/" or the separator.
+// The pattern is validated by expanding it with a dummy name.
+func CompilePatternTemplate(pattern string, separator rune) (*PatternTemplate, error) {
+	t := &PatternTemplate{
+		Pattern:   pattern,
+		separator: separator,
+		literal:   !strings.ContainsAny(replacePlaceholders(pattern, "", ""), "*?[{"),
+	}
+	if _, _, err := t.compileExpanded(replacePlaceholders(pattern, "dir", "parent")); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Expand the template for the directory, names are quoted by glob.QuoteMeta if quote is true
+func (t *PatternTemplate) expand(dir *Candidate, quote bool) string {
+	name, parent := dir.Name(), dir.fsys.Base(dir.Join(".."))
+	if quote {
+		name, parent = glob.QuoteMeta(name), glob.QuoteMeta(parent)
+	}
+	return replacePlaceholders(t.Pattern, name, parent)
+}
+
+// Expand the template for the directory and compile the result, either the glob or the path pattern returned is nil
+func (t *PatternTemplate) compile(dir *Candidate) (glob.Glob, *PathPattern, error) {
+	return t.compileExpanded(t.expand(dir, true))
+}
+
+func (t *PatternTemplate) compileExpanded(expanded string) (glob.Glob, *PathPattern, error) {
+	if strings.ContainsRune(expanded, '/') || strings.ContainsRune(expanded, t.separator) {
+		pattern, err := CompilePathPattern(expanded, t.separator)
+		return nil, pattern, err
+	}
+	g, err := glob.Compile(expanded, t.separator)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid pattern %q: %w", t.Pattern, err)
+	}
+	return g, nil, nil
+}
+
+func replacePlaceholders(s, name, parent string) string {
+	return strings.NewReplacer(PlaceholderDirName, name, PlaceholderParent, parent).Replace(s)
+}
+
+// Find names (or relative paths) of the entries matching the template expanded for the directory
+func findTemplateFlagFiles(dir *Candidate, template *PatternTemplate, filters []EntryFilter) ([]string, error) {
+	g, pattern, err := template.compile(dir)
+	if err != nil {
+		return nil, err
+	}
+	if pattern != nil {
+		return pattern.find(dir, filters)
+	}
+	flagFiles, err := findFlagFiles(dir, []glob.Glob{g}, filters)
+	return flagFiles[0], err
+}
+
+// Replace the template of the clause with the file, glob or path pattern it is expanded to for the directory
+func expandCheckClause(dir *Candidate, clause CheckClause) (CheckClause, error) {
+	template := clause.Template
+	clause.Template = nil
+	if template.literal {
+		clause.File, clause.Glob, clause.Pattern = template.expand(dir, false), nil, nil
+		return clause, nil
+	}
+	var err error
+	clause.Glob, clause.Pattern, err = template.compile(dir)
+	return clause, err
+}
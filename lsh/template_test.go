@@ -0,0 +1,117 @@
+package lsh
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var dotnetFS = fstest.MapFS{
+	"src/App/App.csproj":        {Data: []byte("<Project/>\n")},
+	"src/Lib/Lib.csproj":        {Data: []byte("<Project/>\n")},
+	"src/Lib/Lib.Tests.csproj":  {Data: []byte("<Project/>\n")},
+	"src/Other/App.csproj":      {Data: []byte("<Project/>\n")},
+	"src/[x]/[x].csproj":        {Data: []byte("<Project/>\n")},
+	"src/App.md":                {Data: []byte("# App\n")},
+	"src/Lib.md":                {Data: []byte("owner: team-lib\n")},
+	"src/Other/src/Other.cs":    {Data: []byte("class Other {}\n")},
+	"src/Other/docs/Other.md":   {Data: []byte("# Other\n")},
+	"src/Other/docs/README.txt": {Data: []byte("see Other.md\n")},
+}
+
+func TestCompilePatternTemplate(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		err     string
+	}{
+		{"{dirname}.csproj", ""},
+		{"{dirname}*.{csproj,fsproj}", ""},
+		{"../{parent}/{dirname}.md", ""},
+		{"{dirname}[", `invalid pattern "{dirname}[": unexpected end of input`},
+		{"{dirname}/..", `invalid path pattern "dir/..": it must end with a name or glob`},
+	} {
+		_, err := CompilePatternTemplate(tc.pattern, '/')
+		if tc.err == "" {
+			assert.Nil(t, err, tc.pattern)
+		} else {
+			assert.EqualError(t, err, tc.err)
+		}
+	}
+}
+
+func TestFlagFileTemplates(t *testing.T) {
+	for _, tc := range []struct {
+		templates []string
+		all       bool
+		expected  []string
+	}{
+		{[]string{"{dirname}.csproj"}, false, []string{"src/App", "src/Lib", "src/[x]"}},
+		{[]string{"{dirname}*.csproj"}, false, []string{"src/App", "src/Lib", "src/[x]"}},
+		{[]string{"../{dirname}.md"}, false, []string{"src/App", "src/Lib"}},
+		{[]string{"{parent}.md"}, false, []string{"src/Other/docs"}},
+		{[]string{"{dirname}.csproj", "../{dirname}.md"}, true, []string{"src/App", "src/Lib"}},
+	} {
+		options := fsOptionsForTesting()
+		for _, template := range tc.templates {
+			tpl, err := CompilePatternTemplate(template, '/')
+			assert.Nil(t, err)
+			options.FlagFileTemplates = append(options.FlagFileTemplates, tpl)
+		}
+		options.MatchAllFlagFiles = tc.all
+		found, errs := LsHavingFS(dotnetFS, options, ".")
+		assert.Nil(t, errs)
+		assert.Equal(t, tc.expected, found, tc.templates)
+	}
+}
+
+func TestFlagFileTemplatesResults(t *testing.T) {
+	options := fsOptionsForTesting("*.csproj")
+	tpl, _ := CompilePatternTemplate("{dirname}.*", '/')
+	options.FlagFileTemplates = []*PatternTemplate{tpl}
+	options.MatchAllFlagFiles = true
+	options.FS = dotnetFS
+	found, errs := LsHavingResults(context.Background(), options, "src/Lib")
+	assert.Nil(t, errs)
+	assert.Equal(t, 1, len(found))
+	assert.Equal(t, [][]string{{"Lib.Tests.csproj", "Lib.csproj"}, {"Lib.Tests.csproj", "Lib.csproj"}}, found[0].FlagFiles)
+}
+
+func TestCheckClauseTemplate(t *testing.T) {
+	for _, tc := range []struct {
+		template string
+		regexp   string
+		expected []string
+		checks   []CheckResult
+	}{
+		{"../{dirname}.md", "owner", []string{"src/Lib"}, []CheckResult{{File: "src/Lib.md", Outcome: CheckFileMatched}}},
+		{"docs/{dirname}.*", "Other", []string{"src/Other"}, []CheckResult{{File: "src/Other/docs/Other.md", Outcome: CheckFileMatched}}},
+		{"{dirname}.csproj", "Project", []string{"src/App", "src/Lib", "src/[x]"}, []CheckResult{{File: "src/App/App.csproj", Outcome: CheckFileMatched}}},
+	} {
+		options := fsOptionsForTesting("*.csproj", "docs")
+		tpl, err := CompilePatternTemplate(tc.template, '/')
+		assert.Nil(t, err)
+		options.Checks = []CheckClause{{Template: tpl, Regexp: regexp.MustCompile(tc.regexp)}}
+		options.FS = dotnetFS
+		found, errs := LsHavingResults(context.Background(), options, ".")
+		assert.Nil(t, errs)
+		var paths []string
+		for _, result := range found {
+			paths = append(paths, result.Path)
+		}
+		assert.Equal(t, tc.expected, paths, tc.template)
+		assert.Equal(t, tc.checks, found[0].Checks, tc.template)
+	}
+}
+
+func TestPathPatternParent(t *testing.T) {
+	options := fsOptionsForTesting()
+	pattern, err := CompilePathPattern("../*.md", '/')
+	assert.Nil(t, err)
+	options.FlagPaths = []*PathPattern{pattern}
+	found, errs := LsHavingFS(dotnetFS, options, ".")
+	assert.Nil(t, errs) // there is nothing above the root of an fs.FS
+	assert.Equal(t, []string{"src/App", "src/Lib", "src/Other", "src/[x]"}, found)
+}
@@ -0,0 +1,395 @@
+package lsh
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Condition on the nodes selected by an XPath-like selector in an XML document
+type XPathPredicate struct {
+	// The expression that the predicate is parsed from
+	Expression string
+
+	path       xpathPath
+	comparison xpathComparison
+}
+
+// A location path, such like "/project/dependencies/dependency"
+type xpathPath []xpathStep
+
+// A step in a location path, such like "//dependency[scope='test']" or "@id"
+type xpathStep struct {
+	descendant bool   // "//" instead of "/"
+	attribute  bool   // "@" before the name
+	space      string // namespace URI, empty for matching any namespace
+	local      string // local name, "*" for matching any name
+	predicates []xpathStepPredicate
+}
+
+// Condition in "[...]" of a step
+type xpathStepPredicate struct {
+	position   int // starting from 1, or 0 if it is not a position
+	path       xpathPath
+	comparison xpathComparison
+}
+
+// Comparison between the values of the nodes selected and a literal
+type xpathComparison struct {
+	operator string // empty for checking existence only
+	value    string
+	regexp   *regexp.Regexp
+}
+
+// Parse an expression into an XPathPredicate.
+//
+// The expression is an absolute location path optionally followed by an operator and a quoted value:
+//
+//	/project/packaging                                     the element exists
+//	/project/packaging = 'war'                             the text of the element equals to the value
+//	/project/packaging != 'war'                            the element exists, and its text does not equal to the value
+//	/project/version =~ '^1\.'                             the text of the element matches the regular expression
+//	/project/version !~ '^1\.'                             the element exists, and its text does not match the regular expression
+//	//dependency[artifactId='spring-boot-starter-web']     such an element exists at any level
+//	/project/modules/module[2]                             the second module element exists
+//	/project/@xsi:schemaLocation                           the attribute exists
+//
+// Names without prefixes match elements and attributes in any namespace by their local names.
+// Names with prefixes (such like "m:project") match those in the namespaces that the prefixes are mapped to,
+// the mapping is specified by the namespaces parameter.
+// "*" matches any name.
+// Inside "[...]", there could be a position starting from 1, or a relative location path optionally followed by an operator and a value.
+// Text of an element is the text of all its descendants with leading and trailing spaces trimmed.
+func ParseXPathPredicate(expression string, namespaces map[string]string) (*XPathPredicate, error) {
+	p := xpathParser{input: expression, namespaces: namespaces}
+	p.skipSpaces()
+	if !strings.HasPrefix(p.rest(), "/") {
+		return nil, p.errorf("path must start with \"/\"")
+	}
+	path, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	comparison, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpaces(); p.pos < len(p.input) {
+		return nil, p.errorf("unexpected %q", p.rest())
+	}
+	return &XPathPredicate{Expression: expression, path: path, comparison: comparison}, nil
+}
+
+type xpathParser struct {
+	input      string
+	pos        int
+	namespaces map[string]string
+}
+
+func (p *xpathParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("invalid XPath expression %q at position %d: %s", p.input, p.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *xpathParser) rest() string {
+	return p.input[p.pos:]
+}
+
+func (p *xpathParser) skipSpaces() {
+	for p.pos < len(p.input) && p.input[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// path := ("/" | "//")? step (("/" | "//") step)*
+func (p *xpathParser) parsePath() (xpathPath, error) {
+	var path xpathPath
+	for {
+		var step xpathStep
+		switch {
+		case strings.HasPrefix(p.rest(), "//"):
+			p.pos += 2
+			step.descendant = true
+		case strings.HasPrefix(p.rest(), "/"):
+			p.pos++
+		case len(path) > 0: // end of the path
+			return path, nil
+		}
+		if err := p.parseStep(&step); err != nil {
+			return nil, err
+		}
+		path = append(path, step)
+		if step.attribute && strings.HasPrefix(p.rest(), "/") {
+			return nil, p.errorf("attribute must be the last step")
+		}
+	}
+}
+
+// step := "@"? ("*" | name | prefix ":" name) ("[" predicate "]")*
+func (p *xpathParser) parseStep(step *xpathStep) error {
+	if strings.HasPrefix(p.rest(), "@") {
+		p.pos++
+		step.attribute = true
+	}
+	if strings.HasPrefix(p.rest(), "*") {
+		p.pos++
+		step.local = "*"
+	} else {
+		start := p.pos
+		name := p.parseName()
+		if name == "" {
+			return p.errorf("expecting a name")
+		}
+		if prefix, local, found := strings.Cut(name, ":"); found {
+			space, bound := p.namespaces[prefix]
+			if !bound {
+				p.pos = start
+				return p.errorf("namespace prefix %q is not mapped", prefix)
+			}
+			step.space, step.local = space, local
+		} else {
+			step.local = name
+		}
+	}
+	for strings.HasPrefix(p.rest(), "[") {
+		p.pos++
+		p.skipSpaces()
+		predicate, err := p.parseStepPredicate()
+		if err != nil {
+			return err
+		}
+		if p.skipSpaces(); !strings.HasPrefix(p.rest(), "]") {
+			return p.errorf("expecting \"]\"")
+		}
+		p.pos++
+		step.predicates = append(step.predicates, predicate)
+	}
+	return nil
+}
+
+func (p *xpathParser) parseName() string {
+	start := p.pos
+	for p.pos < len(p.input) && isXMLNameChar(p.input[p.pos]) {
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+func isXMLNameChar(c byte) bool {
+	return c == '_' || c == '-' || c == '.' || c == ':' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+// predicate := position | path comparison
+func (p *xpathParser) parseStepPredicate() (xpathStepPredicate, error) {
+	start := p.pos
+	for p.pos < len(p.input) && p.input[p.pos] >= '0' && p.input[p.pos] <= '9' {
+		p.pos++
+	}
+	if p.pos > start {
+		position, _ := strconv.Atoi(p.input[start:p.pos])
+		if position == 0 {
+			p.pos = start
+			return xpathStepPredicate{}, p.errorf("position starts from 1")
+		}
+		return xpathStepPredicate{position: position}, nil
+	}
+	path, err := p.parsePath()
+	if err != nil {
+		return xpathStepPredicate{}, err
+	}
+	comparison, err := p.parseComparison()
+	return xpathStepPredicate{path: path, comparison: comparison}, err
+}
+
+// comparison := (("=" | "!=" | "=~" | "!~") quoted-value)?
+func (p *xpathParser) parseComparison() (xpathComparison, error) {
+	var comparison xpathComparison
+	p.skipSpaces()
+	for _, operator := range []string{"=~", "!~", "!=", "="} {
+		if strings.HasPrefix(p.rest(), operator) {
+			comparison.operator = operator
+			p.pos += len(operator)
+			break
+		}
+	}
+	if comparison.operator == "" {
+		return comparison, nil
+	}
+	p.skipSpaces()
+	rest := p.rest()
+	if rest == "" || rest[0] != '\'' && rest[0] != '"' {
+		return comparison, p.errorf("expecting a quoted value")
+	}
+	end := strings.IndexByte(rest[1:], rest[0])
+	if end < 0 {
+		return comparison, p.errorf("missing closing quote")
+	}
+	comparison.value = rest[1 : end+1]
+	if comparison.operator == "=~" || comparison.operator == "!~" {
+		re, err := regexp.Compile(comparison.value)
+		if err != nil {
+			return comparison, p.errorf("%s", err)
+		}
+		comparison.regexp = re
+	}
+	p.pos += end + 2
+	return comparison, nil
+}
+
+func (x *XPathPredicate) Test(file string, content []byte) (bool, error) {
+	document, err := parseXML(content)
+	if err != nil {
+		return false, err
+	}
+	return x.comparison.test(x.path.selectFrom(document)), nil
+}
+
+// An element in the XML document
+type xmlNode struct {
+	name     xml.Name
+	attrs    []xml.Attr
+	children []*xmlNode
+	text     strings.Builder // text of all descendants
+}
+
+// A node selected, either an element or an attribute
+type xpathItem struct {
+	node *xmlNode
+	attr *xml.Attr
+}
+
+func (i xpathItem) value() string {
+	if i.attr != nil {
+		return i.attr.Value
+	}
+	return strings.TrimSpace(i.node.text.String())
+}
+
+// Parse the XML document, returning the virtual node containing the root element
+func parseXML(content []byte) (*xmlNode, error) {
+	document := &xmlNode{}
+	ancestors := []*xmlNode{document}
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil // good enough for names and values in ASCII
+	}
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			if len(document.children) == 0 {
+				return nil, errors.New("no root element")
+			}
+			return document, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: t.Name, attrs: t.Attr}
+			parent := ancestors[len(ancestors)-1]
+			parent.children = append(parent.children, node)
+			ancestors = append(ancestors, node)
+		case xml.EndElement:
+			ancestors = ancestors[:len(ancestors)-1]
+		case xml.CharData:
+			for _, ancestor := range ancestors[1:] {
+				ancestor.text.Write(t)
+			}
+		}
+	}
+}
+
+// Select nodes by the path, starting from the context node
+func (path xpathPath) selectFrom(context *xmlNode) []xpathItem {
+	items := []xpathItem{{node: context}}
+	for _, step := range path {
+		var selected []xpathItem
+		seen := make(map[xpathItem]emptyStruct)
+		for _, item := range items {
+			if item.node == nil || item.attr != nil {
+				continue
+			}
+			parents := []*xmlNode{item.node}
+			if step.descendant {
+				parents = appendDescendants(parents, item.node)
+			}
+			for _, parent := range parents {
+				for _, found := range step.selectFrom(parent) {
+					if _, duplicated := seen[found]; !duplicated {
+						seen[found] = emptyVar
+						selected = append(selected, found)
+					}
+				}
+			}
+		}
+		items = selected
+	}
+	return items
+}
+
+func appendDescendants(nodes []*xmlNode, node *xmlNode) []*xmlNode {
+	for _, child := range node.children {
+		nodes = appendDescendants(append(nodes, child), child)
+	}
+	return nodes
+}
+
+// Select children or attributes of the parent by the step
+func (step *xpathStep) selectFrom(parent *xmlNode) []xpathItem {
+	var items []xpathItem
+	if step.attribute {
+		for i := range parent.attrs {
+			if step.matchName(parent.attrs[i].Name) {
+				items = append(items, xpathItem{attr: &parent.attrs[i]})
+			}
+		}
+	} else {
+		for _, child := range parent.children {
+			if step.matchName(child.name) {
+				items = append(items, xpathItem{node: child})
+			}
+		}
+	}
+	for _, predicate := range step.predicates {
+		var filtered []xpathItem
+		for i, item := range items {
+			if predicate.position > 0 && predicate.position == i+1 ||
+				predicate.position == 0 && item.node != nil && predicate.comparison.test(predicate.path.selectFrom(item.node)) {
+				filtered = append(filtered, item)
+			}
+		}
+		items = filtered
+	}
+	return items
+}
+
+func (step *xpathStep) matchName(name xml.Name) bool {
+	return (step.local == "*" || step.local == name.Local) && (step.space == "" || step.space == name.Space)
+}
+
+// Check whether the nodes selected satisfy the comparison
+func (c *xpathComparison) test(items []xpathItem) bool {
+	if len(items) == 0 {
+		return false
+	}
+	for _, item := range items {
+		switch c.operator {
+		case "":
+			return true
+		case "=", "!=":
+			if item.value() == c.value {
+				return c.operator == "="
+			}
+		case "=~", "!~":
+			if c.regexp.MatchString(item.value()) {
+				return c.operator == "=~"
+			}
+		}
+	}
+	return c.operator == "!=" || c.operator == "!~"
+}
@@ -0,0 +1,88 @@
+package lsh
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/gobwas/glob"
+	"github.com/stretchr/testify/assert"
+)
+
+var pomFS = fstest.MapFS{
+	"api/pom.xml": {Data: []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<project xmlns="http://maven.apache.org/POM/4.0.0">
+  <artifactId>api</artifactId>
+  <packaging>war</packaging>
+  <dependencies>
+    <dependency>
+      <artifactId>spring-boot-starter-web</artifactId>
+      <version>3.1.0</version>
+    </dependency>
+    <dependency>
+      <artifactId>junit</artifactId>
+      <scope>test</scope>
+    </dependency>
+  </dependencies>
+</project>`)},
+	"lib/pom.xml": {Data: []byte(`<?xml version="1.0" encoding="ISO-8859-1"?>
+<p:project xmlns:p="http://maven.apache.org/POM/4.0.0" xmlns:x="urn:x" x:flavour="plain">
+  <p:artifactId>lib</p:artifactId>
+  <p:packaging>jar</p:packaging>
+  <p:modules><p:module>a</p:module><p:module>b</p:module></p:modules>
+</p:project>`)},
+	"other/pom.xml":   {Data: []byte(`<project xmlns="urn:other"><packaging>war</packaging></project>`)},
+	"invalid/pom.xml": {Data: []byte(`<project><packaging>war</project>`)},
+}
+
+func TestXPathPredicate(t *testing.T) {
+	namespaces := map[string]string{"m": "http://maven.apache.org/POM/4.0.0", "x": "urn:x"}
+	for _, tc := range []struct {
+		expression string
+		expected   []string
+	}{
+		{`/project`, []string{"api", "lib", "other"}},
+		{`/project/packaging = 'war'`, []string{"api", "other"}},
+		{`/project/packaging != "war"`, []string{"lib"}},
+		{`/m:project/m:packaging = 'war'`, []string{"api"}},
+		{`/m:project/*[2] = 'jar'`, []string{"lib"}},
+		{`//dependency[artifactId='spring-boot-starter-web']`, []string{"api"}},
+		{`//dependency[artifactId='spring-boot-starter-web'][version =~ '^3\.']`, []string{"api"}},
+		{`//dependency[scope]/artifactId = 'junit'`, []string{"api"}},
+		{`//dependency[2]/artifactId = 'junit'`, []string{"api"}},
+		{`//dependency[3]`, []string{}},
+		{`/project/modules/module[2] = 'b'`, []string{"lib"}},
+		{`//module !~ '^[ab]$'`, []string{}},
+		{`/project/@x:flavour = 'plain'`, []string{"lib"}},
+		{`/project/@flavour`, []string{"lib"}},
+		{`/project/@*`, []string{"api", "lib", "other"}},
+		{`//artifactId`, []string{"api", "lib"}},
+	} {
+		predicate, err := ParseXPathPredicate(tc.expression, namespaces)
+		assert.Nil(t, err, tc.expression)
+		options := fsOptionsForTesting("pom.xml")
+		options.Checks = []CheckClause{{Glob: glob.MustCompile("*.xml", '/'), Predicates: []ContentPredicate{predicate}}}
+		found, errs := LsHavingFS(pomFS, options, ".")
+		assert.Equal(t, tc.expected, found, tc.expression)
+		assert.Equal(t, 1, len(errs), tc.expression) // invalid/pom.xml can't be parsed
+	}
+}
+
+func TestParseXPathPredicateError(t *testing.T) {
+	for _, tc := range []struct {
+		expression string
+		err        string
+	}{
+		{`project`, `invalid XPath expression "project" at position 1: path must start with "/"`},
+		{`/project/`, `invalid XPath expression "/project/" at position 10: expecting a name`},
+		{`/m:project`, `invalid XPath expression "/m:project" at position 2: namespace prefix "m" is not mapped`},
+		{`/project/@id/name`, `invalid XPath expression "/project/@id/name" at position 13: attribute must be the last step`},
+		{`/project[name`, `invalid XPath expression "/project[name" at position 14: expecting "]"`},
+		{`/project[0]`, `invalid XPath expression "/project[0]" at position 10: position starts from 1`},
+		{`/project = war`, `invalid XPath expression "/project = war" at position 12: expecting a quoted value`},
+		{`/project = 'war`, `invalid XPath expression "/project = 'war" at position 12: missing closing quote`},
+		{`/project 'war'`, `invalid XPath expression "/project 'war'" at position 10: unexpected "'war'"`},
+	} {
+		_, err := ParseXPathPredicate(tc.expression, nil)
+		assert.EqualError(t, err, tc.err)
+	}
+}
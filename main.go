@@ -5,12 +5,16 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gobwas/glob"
 	"github.com/handy-common-utils/ls-having/lsh"
@@ -27,8 +31,11 @@ const OPT_ERROR_IGNORE = "ignore"
 const OPT_ERROR_PRINT = "print"
 
 const DEFAULT_DEPTH = 5
+const DEFAULT_DESCENDANT_DEPTH = 5
 const DEFAULT_CHECK_REGEXP = ".*"
 const DEFAULT_ERROR = OPT_ERROR_IGNORE
+const DEFAULT_JOBS = 1
+const DEFAULT_CHECK_CMD_TIMEOUT = 30 * time.Second
 
 const DEFAULT_EXIT_CODE_WHEN_ERROR = 1
 
@@ -36,28 +43,83 @@ var optHelp *bool
 var optDepth *int
 var optFlagFiles arrayFlag
 var optMatchAllFlagFiles *bool
-var optCheckFile *string
-var optCheckRegexp *string
-var optCheckInverse *bool
+var optMinCount *int
+var optMaxCount *int
+var optFlagType *string
+var optNewerThan *string
+var optOlderThan *string
+var optMinSize *string
+var optMaxSize *string
+var optExecutable *bool
+var optNotExecutable *bool
+var optNonEmpty *bool
+var optAbsentFiles arrayFlag
+var optAncestorFiles arrayFlag
+var optDescendantFiles arrayFlag
+var optDescendantDepth *int
+var optChecks checkClausesFlag
+var optMatchAnyCheck *bool
+var optXMLNamespaces arrayFlag
+var optDependsOn arrayFlag
+var optCheckCmd *string
+var optCheckCmdTimeout *time.Duration
+var optCheckCmdJobs *int
 var optExcludes arrayFlag
+var optDirNames arrayFlag
+var optPathRegexp *string
 var optNoDefaultExcludes *bool
 var optOnlySubdirectories *bool
 var optPrint0 *bool
 var optError *string
+var optJobs *int
+var optJSON *bool
+var optLabelRoot *bool
+var optWhere *string
 
 func setupFlags() {
 	optHelp = flag.Bool("help", false, "show help information")
 	optDepth = flag.Int("depth", DEFAULT_DEPTH, "how deep to look into subdirectories, 0 means only look at root directory, -1 means no limit")
-	flag.Var(&optFlagFiles, "flag-file", "name or `glob` of the flag file, this option can appear multiple times")
+	flag.Var(&optFlagFiles, "flag-file", "name or `glob` (it could be a relative path such like 'src/main/java' or '.github/workflows/*.yml') of the flag file, {dirname} and {parent} in it are replaced by names of the directory and its parent, this option can appear multiple times")
 	optMatchAllFlagFiles = flag.Bool("match-all-flag-files", false, "require all (instead of any) of the flag file names/globs to be matched")
-	optCheckFile = flag.String("check-file", "", "`name` of the additional file to check")
-	optCheckRegexp = flag.String("check-regexp", DEFAULT_CHECK_REGEXP, "regular `expression` for testing the content of the check file")
-	optCheckInverse = flag.Bool("check-inverse", false, "regard regular expression not matching as positive")
+	optMinCount = flag.Int("min-count", 1, "minimum number of entries matching a flag file name/glob for it to be regarded as matched")
+	optMaxCount = flag.Int("max-count", 0, "maximum number of entries matching a flag file name/glob for it to be regarded as matched, 0 means no limit")
+	optFlagType = flag.String("flag-type", "", "`types` (any combination of f for regular file, d for directory and l for symbolic link) of the entries that can be regarded as flag files")
+	optNewerThan = flag.String("newer-than", "", "`age` (such like 30d, 2w, 1y or 12h) that flag files must be modified within")
+	optOlderThan = flag.String("older-than", "", "`age` (such like 30d, 2w, 1y or 12h) that flag files must have not been modified within")
+	optMinSize = flag.String("min-size", "", "minimum `size` (such like 100, 10k, 2M or 1G) of flag files that are not directories")
+	optMaxSize = flag.String("max-size", "", "maximum `size` (such like 100, 10k, 2M or 1G) of flag files that are not directories")
+	optExecutable = flag.Bool("executable", false, "require flag files to be executable")
+	optNotExecutable = flag.Bool("not-executable", false, "require flag files to be not executable")
+	optNonEmpty = flag.Bool("non-empty", false, "require flag files that are not directories to be non-empty")
+	flag.Var(&optAbsentFiles, "not-having", "name or `glob` of the file that directories must not have, this option can appear multiple times")
+	flag.Var(&optAncestorFiles, "ancestor-having", "name or `glob` of the file that any ancestor (up to the root directory) of directories must have, this option can appear multiple times")
+	flag.Var(&optDescendantFiles, "descendant-having", "name or `glob` of the file that directories must have in them or in any of their subdirectories, this option can appear multiple times")
+	optDescendantDepth = flag.Int("descendant-depth", DEFAULT_DESCENDANT_DEPTH, "how deep to look for files specified by --descendant-having, 1 means only look at files in the directory, -1 means no limit")
+	flag.Var(checkFileFlag{&optChecks}, "check-file", "`name` (or glob) of the additional file to check, {dirname} and {parent} in it are replaced by names of the directory and its parent, this option can appear multiple times")
+	flag.Var(checkRegexpFlag{&optChecks}, "check-regexp", "regular `expression` for testing the content of the most recent check file (default \".*\")")
+	flag.Var(checkPathFlag{&optChecks}, "check-path", "path `expression` (such like '.engines.node =~ ^18') that the JSON/YAML/TOML content of the most recent check file must satisfy, this option can appear multiple times")
+	flag.Var(checkKeyFlag{&optChecks}, "check-key", "key `expression` (such like 'org.gradle.caching == true') that the .properties/.env/INI content of the most recent check file must satisfy, this option can appear multiple times")
+	flag.Var(checkXPathFlag{&optChecks}, "check-xpath", "XPath-like `expression` (such like \"/project/packaging = 'war'\") that the XML content of the most recent check file must satisfy, this option can appear multiple times")
+	flag.Var(&optXMLNamespaces, "xml-ns", "`prefix=uri` mapping of the namespace prefix used in XPath-like expressions, this option can appear multiple times")
+	flag.Var(checkInverseFlag{&optChecks}, "check-inverse", "regard regular expression not matching as positive for the most recent check file")
+	flag.Var(checkUpwardFlag{&optChecks}, "check-upward", "look for the most recent check file in ancestors (up to the root directory) if it does not exist in the directory")
+	flag.Var(checkNearestAncestorFlag{&optChecks}, "check-nearest-ancestor", "check the most recent check file in the nearest ancestor (up to the root directory) having it, instead of the one in the directory")
+	optMatchAnyCheck = flag.Bool("match-any-check", false, "require any (instead of all) of the check files to pass checking")
+	flag.Var(&optDependsOn, "depends-on", "dependency `constraint` (such like 'aws-sdk<3') that package.json, go.mod or build.gradle in directories must satisfy, this option can appear multiple times")
+	optCheckCmd = flag.String("check-cmd", "", "`command` that must exit with code 0 when it is run (by 'sh -c', or 'cmd /C' on Windows) in directories, it is run only if all other conditions are satisfied")
+	optCheckCmdTimeout = flag.Duration("check-cmd-timeout", DEFAULT_CHECK_CMD_TIMEOUT, "how long the check command can run in a directory, 0 means no limit")
+	optCheckCmdJobs = flag.Int("check-cmd-jobs", 0, "how many check commands can run concurrently, 0 means no limit other than --jobs")
+	optWhere = flag.String("where", "", "query `expression` that directories must match, such like 'has(\"package.json\") && !has(\"tsconfig.json\")'")
+	flag.Var(&optDirNames, "dir-name", "`glob` that names of the directories must match (subdirectories of those not matching are still looked into), this option can appear multiple times")
+	optPathRegexp = flag.String("path-regexp", "", "regular `expression` that paths of the directories must match (subdirectories of those not matching are still looked into)")
 	flag.Var(&optExcludes, "exclude", "`glob` of the directories to exclude, this option can appear multiple times")
 	optNoDefaultExcludes = flag.Bool("no-default-excludes", false, "don't apply default excludes")
 	optOnlySubdirectories = flag.Bool("subdirectories-only", false, "don't return root directory even if it meets conditions")
 	optPrint0 = flag.Bool("print0", false, "separate paths in the output with null characters (instead of newline characters)")
 	optError = flag.String("error", DEFAULT_ERROR, "how (`ignore|panic|print`) to handle errors such like non-existing directory, no access permission, etc.")
+	optJobs = flag.Int("jobs", DEFAULT_JOBS, "how many directories to look into concurrently")
+	optLabelRoot = flag.Bool("label-root", false, "print the root directory that each directory was found under, followed by a tab character, before the directory")
+	optJSON = flag.Bool("json", false, "print details (such like the flag files matched) of the directories in JSON format")
 
 	getopt.Aliases(
 		"h", "help",
@@ -72,6 +134,8 @@ func setupFlags() {
 		"s", "subdirectories-only",
 		"0", "print0",
 		"r", "error",
+		"j", "jobs",
+		"w", "where",
 	)
 	flag.Usage = func() {
 		// do nothing, just to avoid getopt to show usage after warning/error info
@@ -84,13 +148,38 @@ func parseFlags() {
 	*optDepth = DEFAULT_DEPTH
 	optFlagFiles = nil
 	*optMatchAllFlagFiles = false
-	*optCheckFile = ""
-	*optCheckRegexp = DEFAULT_CHECK_REGEXP
-	*optCheckInverse = false
+	*optMinCount = 1
+	*optMaxCount = 0
+	*optFlagType = ""
+	*optNewerThan = ""
+	*optOlderThan = ""
+	*optMinSize = ""
+	*optMaxSize = ""
+	*optExecutable = false
+	*optNotExecutable = false
+	*optNonEmpty = false
+	optAbsentFiles = nil
+	optAncestorFiles = nil
+	optDescendantFiles = nil
+	*optDescendantDepth = DEFAULT_DESCENDANT_DEPTH
+	optChecks = nil
+	*optMatchAnyCheck = false
+	optXMLNamespaces = nil
+	optDependsOn = nil
+	*optCheckCmd = ""
+	*optCheckCmdTimeout = DEFAULT_CHECK_CMD_TIMEOUT
+	*optCheckCmdJobs = 0
 	optExcludes = nil
+	optDirNames = nil
+	*optPathRegexp = ""
 	*optNoDefaultExcludes = false
 	*optOnlySubdirectories = false
 	*optPrint0 = false
+	*optJobs = DEFAULT_JOBS
+	*optJSON = false
+	*optLabelRoot = false
+	*optWhere = ""
+	*optError = DEFAULT_ERROR
 
 	getopt.Parse()
 }
@@ -103,18 +192,30 @@ func doMain(printOutput func(text string), handleError func(errors []string, pri
 		return
 	}
 
-	var optRootDir = getopt.CommandLine.Arg(0)
-	if optRootDir == "" {
-		optRootDir = "."
+	var optRootDirs = getopt.CommandLine.Args()
+	if len(optRootDirs) == 0 {
+		optRootDirs = []string{"."}
 	}
 
-	if len(optFlagFiles) == 0 {
-		if len(*optCheckFile) == 0 {
+	if len(optChecks) > 0 && optChecks[0].file == "" {
+		// -e/--check-regexp and -i/--check-inverse without -c/--check-file are ignored,
+		// but other options of the clause make no sense without a check file
+		if option := optChecks[0].optionRequiringFile(); option != "" {
+			handleError([]string{option + " requires -c/--check-file"}, false, DEFAULT_EXIT_CODE_WHEN_ERROR)
+			return
+		}
+		optChecks = optChecks[1:]
+	}
+
+	if len(optFlagFiles) == 0 && len(*optWhere) == 0 && len(optDependsOn) == 0 {
+		if len(optChecks) == 0 {
 			handleError([]string{"flag file or check file must be specified"}, true, DEFAULT_EXIT_CODE_WHEN_ERROR)
 			return
 		} else {
-			// assuming the check file is also the flag file
-			optFlagFiles = append(optFlagFiles, *optCheckFile)
+			// assuming the check files are also the flag files
+			for _, check := range optChecks {
+				optFlagFiles = append(optFlagFiles, check.file)
+			}
 		}
 	}
 
@@ -130,46 +231,445 @@ func doMain(printOutput func(text string), handleError func(errors []string, pri
 	}
 
 	var options = lsh.Options{
-		Depth:             *optDepth,
-		Excludes:          compileGlobs(optExcludes, filepath.Separator),
-		ExcludeRoot:       *optOnlySubdirectories,
-		FlagFiles:         compileGlobs(optFlagFiles, filepath.Separator),
-		MatchAllFlagFiles: *optMatchAllFlagFiles,
-		CheckFile:         *optCheckFile,
-		CheckRegexp:       regexp.MustCompile(*optCheckRegexp),
-		CheckInverse:      *optCheckInverse,
-		PanicOnError:      *optError == OPT_ERROR_PANIC,
-	}
-	var dirs, errors = lsh.LsHaving(&options, optRootDir)
+		Depth:                   *optDepth,
+		ExcludeRoot:             *optOnlySubdirectories,
+		MatchAllFlagFiles:       *optMatchAllFlagFiles,
+		MinFlagFileCount:        *optMinCount,
+		MaxFlagFileCount:        *optMaxCount,
+		DescendantDepth:         *optDescendantDepth,
+		MatchAnyCheck:           *optMatchAnyCheck,
+		CheckCommand:            *optCheckCmd,
+		CheckCommandTimeout:     *optCheckCmdTimeout,
+		CheckCommandConcurrency: *optCheckCmdJobs,
+		PanicOnError:            *optError == OPT_ERROR_PANIC,
+		Concurrency:             *optJobs,
+	}
+	var err error
+	if options.Excludes, err = compileGlobs(optExcludes, filepath.Separator, "-x/--exclude"); err != nil {
+		handleError([]string{err.Error()}, false, DEFAULT_EXIT_CODE_WHEN_ERROR)
+		return
+	}
+	if options.DirNames, err = compileGlobs(optDirNames, filepath.Separator, "--dir-name"); err != nil {
+		handleError([]string{err.Error()}, false, DEFAULT_EXIT_CODE_WHEN_ERROR)
+		return
+	}
+	if options.AbsentFiles, err = compileGlobs(optAbsentFiles, filepath.Separator, "--not-having"); err != nil {
+		handleError([]string{err.Error()}, false, DEFAULT_EXIT_CODE_WHEN_ERROR)
+		return
+	}
+	if options.AncestorFlagFiles, err = compileGlobs(optAncestorFiles, filepath.Separator, "--ancestor-having"); err != nil {
+		handleError([]string{err.Error()}, false, DEFAULT_EXIT_CODE_WHEN_ERROR)
+		return
+	}
+	if options.DescendantFlagFiles, err = compileGlobs(optDescendantFiles, filepath.Separator, "--descendant-having"); err != nil {
+		handleError([]string{err.Error()}, false, DEFAULT_EXIT_CODE_WHEN_ERROR)
+		return
+	}
+	if *optPathRegexp != "" {
+		pathRegexp, err := regexp.Compile(*optPathRegexp)
+		if err != nil {
+			handleError([]string{err.Error()}, false, DEFAULT_EXIT_CODE_WHEN_ERROR)
+			return
+		}
+		options.PathRegexp = pathRegexp
+	}
+	if *optDescendantDepth == 0 {
+		handleError([]string{"--descendant-depth must not be 0"}, false, DEFAULT_EXIT_CODE_WHEN_ERROR)
+		return
+	}
+	if *optMaxCount > 0 && *optMaxCount < *optMinCount {
+		handleError([]string{"--max-count must not be less than --min-count"}, false, DEFAULT_EXIT_CODE_WHEN_ERROR)
+		return
+	}
+	flagFiles, flagPaths, flagFileTemplates, flagFileNames, err := compileFlagFiles(optFlagFiles, filepath.Separator)
+	if err != nil {
+		handleError([]string{err.Error()}, false, DEFAULT_EXIT_CODE_WHEN_ERROR)
+		return
+	}
+	options.FlagFiles, options.FlagPaths, options.FlagFileTemplates = flagFiles, flagPaths, flagFileTemplates
+	flagFileTypes, err := parseEntryTypes(*optFlagType)
+	if err != nil {
+		handleError([]string{err.Error()}, false, DEFAULT_EXIT_CODE_WHEN_ERROR)
+		return
+	}
+	options.FlagFileTypes = flagFileTypes
+	flagFileFilters, err := buildFlagFileFilters(time.Now())
+	if err != nil {
+		handleError([]string{err.Error()}, false, DEFAULT_EXIT_CODE_WHEN_ERROR)
+		return
+	}
+	options.FlagFileFilters = flagFileFilters
+	checks, err := compileChecks(optChecks, filepath.Separator, optXMLNamespaces)
+	if err != nil {
+		handleError([]string{err.Error()}, false, DEFAULT_EXIT_CODE_WHEN_ERROR)
+		return
+	}
+	options.Checks = checks
+	for _, expression := range optDependsOn {
+		constraint, err := lsh.ParseDependencyConstraint(expression)
+		if err != nil {
+			handleError([]string{err.Error()}, false, DEFAULT_EXIT_CODE_WHEN_ERROR)
+			return
+		}
+		options.DependsOn = append(options.DependsOn, constraint)
+	}
+	if len(*optWhere) > 0 {
+		whereMatcher, err := lsh.ParseQuery(*optWhere, filepath.Separator)
+		if err != nil {
+			handleError([]string{err.Error()}, false, DEFAULT_EXIT_CODE_WHEN_ERROR)
+			return
+		}
+		// the check command should run only if the query expression is satisfied too
+		defaultOptions := options
+		defaultOptions.CheckCommand = ""
+		matchers := []lsh.Matcher{lsh.DefaultMatcher(&defaultOptions), whereMatcher}
+		if options.CheckCommand != "" {
+			matchers = append(matchers, lsh.CommandMatcher(options.CheckCommand, options.CheckCommandTimeout, options.CheckCommandConcurrency))
+		}
+		options.Matcher = lsh.And(matchers...)
+	}
+	var results, errors = lsh.LsHavingResults(context.Background(), &options, optRootDirs...)
 	if errors != nil {
+		errorMessages := make([]string, len(errors))
+		for i, err := range errors {
+			errorMessages[i] = err.Error()
+		}
 		switch *optError {
 		case OPT_ERROR_PANIC:
-			handleError(errors, false, DEFAULT_EXIT_CODE_WHEN_ERROR)
+			handleError(errorMessages, false, DEFAULT_EXIT_CODE_WHEN_ERROR)
 			return
 		case OPT_ERROR_PRINT:
-			handleError(errors, false, 0)
+			handleError(errorMessages, false, 0)
 			// continue to print out results
 		default:
 			// do nothing
 			// continue to print out results
 		}
 	}
-	if len(dirs) > 0 {
+	if *optJSON {
+		printOutput(formatResultsInJSON(results, flagFileNames))
+		printOutput("\n")
+	} else if len(results) > 0 {
 		separator := "\n"
 		if *optPrint0 {
 			separator = string([]byte{0})
 		}
+		dirs := make([]string, len(results))
+		for i, result := range results {
+			if *optLabelRoot {
+				dirs[i] = result.Root + "\t" + result.Path
+			} else {
+				dirs[i] = result.Path
+			}
+			for _, value := range capturedValues(result, options.Checks) {
+				dirs[i] += "\t" + value
+			}
+		}
 		printOutput(strings.Join(dirs, separator))
 		printOutput(separator)
 	}
 }
 
-func compileGlobs(globStrings []string, separator rune) []glob.Glob {
+// Values captured by groups in the check regexps, one column for each of the groups of each of the clauses.
+// Values of a clause are empty if its check file was not checked or its content did not match.
+func capturedValues(result *lsh.Result, checks []lsh.CheckClause) []string {
+	var values []string
+	for i, check := range checks {
+		columns := make([]string, check.Regexp.NumSubexp())
+		for _, checkResult := range result.Checks {
+			if checkResult.Clause == i && checkResult.Captures != nil {
+				for j, capture := range checkResult.Captures {
+					columns[j] = capture.Value
+				}
+				break
+			}
+		}
+		values = append(values, columns...)
+	}
+	return values
+}
+
+// Details of a directory found, in the format of JSON output
+type jsonResult struct {
+	Root         string              `json:"root"`
+	Path         string              `json:"path"`
+	Depth        int                 `json:"depth"`
+	FlagFiles    map[string][]string `json:"flagFiles"`
+	Checks       []jsonCheckResult   `json:"checks,omitempty"`
+	Dependencies []jsonDependency    `json:"dependencies,omitempty"`
+}
+
+// Dependency declared, in the format of JSON output
+type jsonDependency struct {
+	File    string `json:"file"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Outcome of checking a check file, in the format of JSON output
+type jsonCheckResult struct {
+	File     string            `json:"file"`
+	Outcome  lsh.CheckOutcome  `json:"outcome"`
+	Captures map[string]string `json:"captures,omitempty"`
+}
+
+// Format results as a JSON array.
+// Flag files matched are keyed by the flag file names/globs specified in the command line.
+func formatResultsInJSON(results []*lsh.Result, flagFiles []string) string {
+	jsonResults := make([]jsonResult, len(results))
+	for i, result := range results {
+		jsonResults[i] = jsonResult{
+			Root:      result.Root,
+			Path:      result.Path,
+			Depth:     result.Depth,
+			FlagFiles: make(map[string][]string),
+		}
+		for _, check := range result.Checks {
+			jsonCheck := jsonCheckResult{File: check.File, Outcome: check.Outcome}
+			if check.Captures != nil {
+				jsonCheck.Captures = make(map[string]string)
+				for _, capture := range check.Captures {
+					jsonCheck.Captures[capture.Name] = capture.Value
+				}
+			}
+			jsonResults[i].Checks = append(jsonResults[i].Checks, jsonCheck)
+		}
+		for _, dependency := range result.Dependencies {
+			jsonResults[i].Dependencies = append(jsonResults[i].Dependencies, jsonDependency{dependency.File, dependency.Name, dependency.Version})
+		}
+		for j, names := range result.FlagFiles {
+			if names != nil {
+				jsonResults[i].FlagFiles[flagFiles[j]] = names
+			}
+		}
+	}
+	bytes, _ := json.MarshalIndent(jsonResults, "", "  ") // there's nothing that can't be marshalled
+	return string(bytes)
+}
+
+func compileGlobs(globStrings []string, separator rune, option string) ([]glob.Glob, error) {
 	result := make([]glob.Glob, len(globStrings))
 	for i, globString := range globStrings {
-		result[i] = glob.MustCompile(globString, separator)
+		g, err := glob.Compile(globString, separator)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s glob %q: %w", option, globString, err)
+		}
+		result[i] = g
+	}
+	return result, nil
+}
+
+// Compile flag file names/globs, those containing path separators are compiled as path patterns,
+// and those containing placeholders are compiled as templates.
+// Names/globs in the order of the flag files in results (globs, then path patterns, then templates) are also returned.
+func compileFlagFiles(flagFiles []string, separator rune) (globs []glob.Glob, paths []*lsh.PathPattern, templates []*lsh.PatternTemplate, names []string, err error) {
+	var pathNames, templateNames []string
+	for _, flagFile := range flagFiles {
+		switch {
+		case lsh.HasPlaceholders(flagFile):
+			template, err := lsh.CompilePatternTemplate(flagFile, separator)
+			if err != nil {
+				return nil, nil, nil, nil, err
+			}
+			templates = append(templates, template)
+			templateNames = append(templateNames, flagFile)
+		case isPath(flagFile, separator):
+			path, err := lsh.CompilePathPattern(flagFile, separator)
+			if err != nil {
+				return nil, nil, nil, nil, err
+			}
+			paths = append(paths, path)
+			pathNames = append(pathNames, flagFile)
+		default:
+			g, err := glob.Compile(flagFile, separator)
+			if err != nil {
+				return nil, nil, nil, nil, fmt.Errorf("invalid flag file glob %q: %w", flagFile, err)
+			}
+			globs = append(globs, g)
+			names = append(names, flagFile)
+		}
+	}
+	return globs, paths, templates, append(append(names, pathNames...), templateNames...), nil
+}
+
+// Check whether the flag/check file is a path containing separators, such like "src/main/java"
+func isPath(file string, separator rune) bool {
+	return strings.ContainsRune(file, '/') || strings.ContainsRune(file, separator)
+}
+
+// Parse types such like "f", "d", "fl" or "f,d" into lsh.EntryType, empty string means any type
+func parseEntryTypes(types string) (lsh.EntryType, error) {
+	var result lsh.EntryType
+	for _, c := range types {
+		switch c {
+		case 'f':
+			result |= lsh.EntryTypeFile
+		case 'd':
+			result |= lsh.EntryTypeDir
+		case 'l':
+			result |= lsh.EntryTypeSymlink
+		case ',', ' ':
+			// separators are allowed
+		default:
+			return 0, fmt.Errorf("invalid flag file type %q in %q, it should be f, d or l", c, types)
+		}
+	}
+	return result, nil
+}
+
+// Build filters of flag files according to options regarding metadata of flag files
+func buildFlagFileFilters(now time.Time) ([]lsh.EntryFilter, error) {
+	var filters []lsh.EntryFilter
+	if *optNewerThan != "" || *optOlderThan != "" {
+		var after, before time.Time
+		if *optNewerThan != "" {
+			age, err := parseAge(*optNewerThan)
+			if err != nil {
+				return nil, err
+			}
+			after = now.Add(-age)
+		}
+		if *optOlderThan != "" {
+			age, err := parseAge(*optOlderThan)
+			if err != nil {
+				return nil, err
+			}
+			before = now.Add(-age)
+		}
+		filters = append(filters, lsh.ModTimeFilter(after, before))
+	}
+	if *optMinSize != "" || *optMaxSize != "" || *optNonEmpty {
+		var minSize, maxSize int64 = 0, -1
+		if *optMinSize != "" {
+			size, err := parseSize(*optMinSize)
+			if err != nil {
+				return nil, err
+			}
+			minSize = size
+		}
+		if *optMaxSize != "" {
+			size, err := parseSize(*optMaxSize)
+			if err != nil {
+				return nil, err
+			}
+			maxSize = size
+		}
+		if *optNonEmpty {
+			minSize = max(minSize, 1)
+		}
+		filters = append(filters, lsh.SizeFilter(minSize, maxSize))
+	}
+	if *optExecutable && *optNotExecutable {
+		return nil, fmt.Errorf("--executable and --not-executable can't be used together")
 	}
-	return result
+	if *optExecutable || *optNotExecutable {
+		filters = append(filters, lsh.ExecutableFilter(*optExecutable))
+	}
+	return filters, nil
+}
+
+// Parse age such like "30d" (days), "2w" (weeks), "1y" (365 days) or anything accepted by time.ParseDuration such like "12h"
+func parseAge(s string) (time.Duration, error) {
+	days := map[byte]int{'d': 1, 'w': 7, 'y': 365}
+	if len(s) > 1 && days[s[len(s)-1]] > 0 {
+		if n, err := strconv.Atoi(s[:len(s)-1]); err == nil && n >= 0 {
+			return time.Duration(n*days[s[len(s)-1]]) * 24 * time.Hour, nil
+		}
+	}
+	age, err := time.ParseDuration(s)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid age %q, it should be like 30d, 2w, 1y or 12h", s)
+	}
+	return age, nil
+}
+
+// Parse size such like "100" (bytes), "10k", "2M" or "1G" (units are powers of 1024, a trailing "B" is allowed)
+func parseSize(s string) (int64, error) {
+	number := strings.TrimSuffix(strings.ToUpper(s), "B")
+	multiplier := int64(1)
+	for i, unit := range "KMGT" {
+		if strings.HasSuffix(number, string(unit)) {
+			number = number[:len(number)-1]
+			multiplier = int64(1) << (10 * (i + 1))
+			break
+		}
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, it should be like 100, 10k, 2M or 1G", s)
+	}
+	return n * multiplier, nil
+}
+
+// Check file names/globs are regarded as globs if they contain any of these characters
+const globMetaCharacters = "*?[{"
+
+func compileChecks(checks []checkClause, separator rune, xmlNamespaces []string) ([]lsh.CheckClause, error) {
+	namespaces := make(map[string]string)
+	for _, xmlNamespace := range xmlNamespaces {
+		prefix, uri, found := strings.Cut(xmlNamespace, "=")
+		if !found || prefix == "" {
+			return nil, fmt.Errorf("invalid XML namespace mapping %q, it should be like prefix=uri", xmlNamespace)
+		}
+		namespaces[prefix] = uri
+	}
+	result := make([]lsh.CheckClause, len(checks))
+	for i, check := range checks {
+		checkRegexp, err := regexp.Compile(check.regexp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid check regexp %q: %w", check.regexp, err)
+		}
+		result[i] = lsh.CheckClause{
+			File:            check.file,
+			Regexp:          checkRegexp,
+			Inverse:         check.inverse,
+			Upward:          check.upward,
+			NearestAncestor: check.nearestAncestor,
+		}
+		if lsh.HasPlaceholders(check.file) {
+			template, err := lsh.CompilePatternTemplate(check.file, separator)
+			if err != nil {
+				return nil, err
+			}
+			result[i].Template = template
+		} else if strings.ContainsAny(check.file, globMetaCharacters) {
+			if isPath(check.file, separator) {
+				pattern, err := lsh.CompilePathPattern(check.file, separator)
+				if err != nil {
+					return nil, err
+				}
+				result[i].Pattern = pattern
+			} else {
+				g, err := glob.Compile(check.file, separator)
+				if err != nil {
+					return nil, fmt.Errorf("invalid check file glob %q: %w", check.file, err)
+				}
+				result[i].Glob = g
+			}
+		}
+		for _, path := range check.paths {
+			predicate, err := lsh.ParsePathPredicate(path)
+			if err != nil {
+				return nil, err
+			}
+			result[i].Predicates = append(result[i].Predicates, predicate)
+		}
+		for _, key := range check.keys {
+			predicate, err := lsh.ParseKeyPredicate(key)
+			if err != nil {
+				return nil, err
+			}
+			result[i].Predicates = append(result[i].Predicates, predicate)
+		}
+		for _, xpath := range check.xpaths {
+			predicate, err := lsh.ParseXPathPredicate(xpath, namespaces)
+			if err != nil {
+				return nil, err
+			}
+			result[i].Predicates = append(result[i].Predicates, predicate)
+		}
+	}
+	return result, nil
 }
 
 type arrayFlag []string
@@ -182,6 +682,156 @@ func (i *arrayFlag) Set(value string) error {
 	return nil
 }
 
+// A check file with the regular expression for checking its content, as specified in the command line
+type checkClause struct {
+	file            string
+	regexp          string
+	paths           []string
+	keys            []string
+	xpaths          []string
+	inverse         bool
+	upward          bool
+	nearestAncestor bool
+}
+
+// Name of the first option in the clause that can't be used without a check file, or empty string if there is none
+func (c *checkClause) optionRequiringFile() string {
+	switch {
+	case len(c.paths) > 0:
+		return "--check-path"
+	case len(c.keys) > 0:
+		return "--check-key"
+	case len(c.xpaths) > 0:
+		return "--check-xpath"
+	case c.upward:
+		return "--check-upward"
+	case c.nearestAncestor:
+		return "--check-nearest-ancestor"
+	default:
+		return ""
+	}
+}
+
+// Check clauses in the order of -c/--check-file options in the command line
+type checkClausesFlag []checkClause
+
+// The clause that -e/--check-regexp, -i/--check-inverse and other options of the clause apply to,
+// which is the most recent one, or the first one if there has been no -c/--check-file yet
+func (c *checkClausesFlag) current() *checkClause {
+	if len(*c) == 0 {
+		*c = append(*c, checkClause{regexp: DEFAULT_CHECK_REGEXP})
+	}
+	return &(*c)[len(*c)-1]
+}
+
+type checkFileFlag struct{ clauses *checkClausesFlag }
+
+func (f checkFileFlag) String() string {
+	return ""
+}
+func (f checkFileFlag) Set(value string) error {
+	if len(*f.clauses) == 1 && (*f.clauses)[0].file == "" { // started by other options of the clause
+		(*f.clauses)[0].file = value
+	} else {
+		*f.clauses = append(*f.clauses, checkClause{file: value, regexp: DEFAULT_CHECK_REGEXP})
+	}
+	return nil
+}
+
+type checkRegexpFlag struct{ clauses *checkClausesFlag }
+
+func (f checkRegexpFlag) String() string {
+	return ""
+}
+func (f checkRegexpFlag) Set(value string) error {
+	f.clauses.current().regexp = value
+	return nil
+}
+
+type checkPathFlag struct{ clauses *checkClausesFlag }
+
+func (f checkPathFlag) String() string {
+	return ""
+}
+func (f checkPathFlag) Set(value string) error {
+	current := f.clauses.current()
+	current.paths = append(current.paths, value)
+	return nil
+}
+
+type checkKeyFlag struct{ clauses *checkClausesFlag }
+
+func (f checkKeyFlag) String() string {
+	return ""
+}
+func (f checkKeyFlag) Set(value string) error {
+	current := f.clauses.current()
+	current.keys = append(current.keys, value)
+	return nil
+}
+
+type checkXPathFlag struct{ clauses *checkClausesFlag }
+
+func (f checkXPathFlag) String() string {
+	return ""
+}
+func (f checkXPathFlag) Set(value string) error {
+	current := f.clauses.current()
+	current.xpaths = append(current.xpaths, value)
+	return nil
+}
+
+type checkInverseFlag struct{ clauses *checkClausesFlag }
+
+func (f checkInverseFlag) IsBoolFlag() bool {
+	return true
+}
+func (f checkInverseFlag) String() string {
+	return ""
+}
+func (f checkInverseFlag) Set(value string) error {
+	inverse, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	f.clauses.current().inverse = inverse
+	return nil
+}
+
+type checkUpwardFlag struct{ clauses *checkClausesFlag }
+
+func (f checkUpwardFlag) IsBoolFlag() bool {
+	return true
+}
+func (f checkUpwardFlag) String() string {
+	return ""
+}
+func (f checkUpwardFlag) Set(value string) error {
+	upward, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	f.clauses.current().upward = upward
+	return nil
+}
+
+type checkNearestAncestorFlag struct{ clauses *checkClausesFlag }
+
+func (f checkNearestAncestorFlag) IsBoolFlag() bool {
+	return true
+}
+func (f checkNearestAncestorFlag) String() string {
+	return ""
+}
+func (f checkNearestAncestorFlag) Set(value string) error {
+	nearestAncestor, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	f.clauses.current().nearestAncestor = nearestAncestor
+	return nil
+}
+
 func printToStdout(text string) {
 	fmt.Print(text)
 }
@@ -205,7 +855,7 @@ func handleError(errors []string, printUsage bool, exitCode int) {
 		}
 	}
 	if printUsage {
-		fmt.Println("Usage: ls-having -f name-or-glob [options] [root-dir]")
+		fmt.Println("Usage: ls-having -f name-or-glob [options] [root-dir ...]")
 		fmt.Println("Options:")
 		getopt.CommandLine.SetOutput(os.Stdout)
 		getopt.PrintDefaults()
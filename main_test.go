@@ -229,6 +229,587 @@ testdata/repo1/outbound/china/mainland
 		`-a -f package.json -f serverless.yml testdata/repo1`,
 		`testdata/repo1/inbound
 testdata/repo1/outbound/New Zealand
+`,
+	},
+	{
+		`-f package.json -j 4 --no-default-excludes testdata/repo1`,
+		`testdata/repo1
+testdata/repo1/inbound
+testdata/repo1/outbound/New Zealand
+testdata/repo1/outbound/china
+testdata/repo1/outbound/china/mainland
+testdata/repo1/outbound/china/mainland/node_modules/package1
+testdata/repo1/outbound/china/mainland/node_modules/package2
+`,
+	},
+	{
+		`-a -f build.gradle -f serverless.* --jobs 3 testdata/repo1`,
+		`testdata/repo1/outbound/australia
+testdata/repo1/outbound/china/sars
+`,
+	},
+	{
+		`-f serverless.* -f build.gradle -c package.json --json testdata/repo1`,
+		`[
+  {
+    "root": "testdata/repo1",
+    "path": "testdata/repo1/inbound",
+    "depth": 1,
+    "flagFiles": {
+      "serverless.*": [
+        "serverless.yml"
+      ]
+    },
+    "checks": [
+      {
+        "file": "testdata/repo1/inbound/package.json",
+        "outcome": "matched"
+      }
+    ]
+  },
+  {
+    "root": "testdata/repo1",
+    "path": "testdata/repo1/outbound/New Zealand",
+    "depth": 2,
+    "flagFiles": {
+      "serverless.*": [
+        "serverless.yml"
+      ]
+    },
+    "checks": [
+      {
+        "file": "testdata/repo1/outbound/New Zealand/package.json",
+        "outcome": "matched"
+      }
+    ]
+  }
+]
+`,
+	},
+	{
+		`-a -f build.gradle* -f serverless.* --json testdata/repo1`,
+		`[
+  {
+    "root": "testdata/repo1",
+    "path": "testdata/repo1/outbound/australia",
+    "depth": 2,
+    "flagFiles": {
+      "build.gradle*": [
+        "build.gradle"
+      ],
+      "serverless.*": [
+        "serverless.yml"
+      ]
+    }
+  },
+  {
+    "root": "testdata/repo1",
+    "path": "testdata/repo1/outbound/china/sars",
+    "depth": 3,
+    "flagFiles": {
+      "build.gradle*": [
+        "build.gradle"
+      ],
+      "serverless.*": [
+        "serverless.ts"
+      ]
+    }
+  }
+]
+`,
+	},
+	{
+		`-f package.json -c ../australia -i --json testdata/repo1/outbound/china`,
+		`[
+  {
+    "root": "testdata/repo1/outbound/china",
+    "path": "testdata/repo1/outbound/china/mainland",
+    "depth": 1,
+    "flagFiles": {
+      "package.json": [
+        "package.json"
+      ]
+    },
+    "checks": [
+      {
+        "file": "testdata/repo1/outbound/china/australia",
+        "outcome": "missing"
+      }
+    ]
+  }
+]
+`,
+	},
+	{
+		`-f nothing --json testdata/repo1`,
+		"[]\n",
+	},
+	{
+		`-f package.json testdata/repo1/outbound testdata/repo1/inbound testdata/repo1/outbound/china`,
+		`testdata/repo1/inbound
+testdata/repo1/outbound/New Zealand
+testdata/repo1/outbound/china
+testdata/repo1/outbound/china/mainland
+`,
+	},
+	{
+		`-f package.json --label-root testdata/repo1/outbound testdata/repo1/inbound testdata/repo1/outbound/china`,
+		`testdata/repo1/inbound	testdata/repo1/inbound
+testdata/repo1/outbound	testdata/repo1/outbound/New Zealand
+testdata/repo1/outbound	testdata/repo1/outbound/china
+testdata/repo1/outbound	testdata/repo1/outbound/china/mainland
+`,
+	},
+	{
+		`-f package.json testdata/non-existing-dir testdata/repo1/inbound`,
+		"testdata/repo1/inbound\n",
+	},
+	{
+		`-w has("package.json")&&!has("serverless.*") testdata/repo1`,
+		`testdata/repo1
+testdata/repo1/outbound/china
+testdata/repo1/outbound/china/mainland
+`,
+	},
+	{
+		`-w has("package.json") --not-having serverless.yml testdata/repo1`,
+		`testdata/repo1
+testdata/repo1/outbound/china
+testdata/repo1/outbound/china/mainland
+`,
+	},
+	{
+		`--where contains("package.json",/"MOCHA"/i)||has("*.ts") testdata/repo1`,
+		`testdata/repo1/inbound
+testdata/repo1/outbound/china/sars
+`,
+	},
+	{
+		`-f package.json -w !contains("package.json","volta") testdata/repo1`,
+		`testdata/repo1
+testdata/repo1/outbound/New Zealand
+testdata/repo1/outbound/china
+testdata/repo1/outbound/china/mainland
+`,
+	},
+	{
+		`-a -f build.gradle* -f serverless.* -w exists("../china")||has("build.gradle.kts") testdata/repo1`,
+		`testdata/repo1/outbound/australia
+`,
+	},
+	{
+		`-f build.gradle* --not-having gradlew testdata/repo1`,
+		`testdata/repo1/outbound/australia
+testdata/repo1/outbound/china/sars
+`,
+	},
+	{
+		`-f build.gradle* --not-having gradlew --not-having serverless.t* testdata/repo1`,
+		`testdata/repo1/outbound/australia
+`,
+	},
+	{
+		`-f package.json --not-having serverless.* -c package.json -e "name": testdata/repo1`,
+		"",
+	},
+	{
+		`-f package.json --not-having *.yml testdata/repo1`,
+		`testdata/repo1
+testdata/repo1/outbound/china
+testdata/repo1/outbound/china/mainland
+`,
+	},
+	{
+		`-f package.* -c package.json -e "@types/mocha": -c serverless.yml testdata/repo1`,
+		`testdata/repo1/inbound
+`,
+	},
+	{
+		`-e "@types/mocha": -c package.json -c serverless.yml testdata/repo1`,
+		`testdata/repo1/inbound
+`,
+	},
+	{
+		`-c package.json -e "@types/mocha": -i -c serverless.yml testdata/repo1`,
+		`testdata/repo1/outbound/New Zealand
+testdata/repo1/outbound/australia
+`,
+	},
+	{
+		`-f package.* -c package.json -e "@types/mocha": -c serverless.* --match-any-check testdata/repo1`,
+		`testdata/repo1/inbound
+testdata/repo1/outbound/New Zealand
+`,
+	},
+	{
+		`-f build.gradle* -c serverless.* testdata/repo1`,
+		`testdata/repo1/outbound/australia
+testdata/repo1/outbound/china/sars
+`,
+	},
+	{
+		`-f build.gradle* -c serverless.* -i -e . testdata/repo1`,
+		`testdata/repo1/outbound/australia
+testdata/repo1/outbound/china/sars
+testdata/repo1/outbound/usa
+`,
+	},
+	{
+		`-c package.json -e "version":\s*"([^"]+)" testdata/repo1`,
+		"testdata/repo1/inbound\t1.1.7\n",
+	},
+	{
+		`-c package.json -e "name":\s*"([^"]+)" -c build.gradle* -e log4j-core:([0-9.]+) --match-any-check testdata/repo1`,
+		"testdata/repo1/inbound\t@handy-common-utils/dev-dependencies\t\ntestdata/repo1/outbound/china/sars\t\t2.17.1\ntestdata/repo1/outbound/usa\t\t2.14.1\n",
+	},
+	{
+		`-c package.json -e "(?P<name>[^"]+)":\s*"([^"]+)" --label-root --depth 1 testdata/repo1`,
+		"testdata/repo1\ttestdata/repo1/inbound\tname\t@handy-common-utils/dev-dependencies\n",
+	},
+	{
+		`-c package.json -e "version":\s*"(?P<version>[^"]+)" --json testdata/repo1`,
+		`[
+  {
+    "root": "testdata/repo1",
+    "path": "testdata/repo1/inbound",
+    "depth": 1,
+    "flagFiles": {
+      "package.json": [
+        "package.json"
+      ]
+    },
+    "checks": [
+      {
+        "file": "testdata/repo1/inbound/package.json",
+        "outcome": "matched",
+        "captures": {
+          "version": "1.1.7"
+        }
+      }
+    ]
+  }
+]
+`,
+	},
+	{
+		`-c package.json --check-path .dependencies["@types/mocha"] testdata/repo1`,
+		`testdata/repo1/inbound
+`,
+	},
+	{
+		`-c package.json --check-path .dependencies["@types/node"]=~^\^10\. --check-path .files[0]==tsconfig.* testdata/repo1`,
+		`testdata/repo1/inbound
+`,
+	},
+	{
+		`-c package.json --check-path .files[0]!=tsconfig.* testdata/repo1`,
+		"",
+	},
+	{
+		`-f package.json -c package.json --check-path .version -i testdata/repo1`,
+		`testdata/repo1
+testdata/repo1/outbound/New Zealand
+testdata/repo1/outbound/china
+testdata/repo1/outbound/china/mainland
+`,
+	},
+	{
+		`-f build.gradle -f mvn.xml -c mvn.xml --check-xpath /project/packaging='war' testdata/repo1`,
+		`testdata/repo1/storage
+`,
+	},
+	{
+		`-c mvn.xml --check-xpath //dependency[artifactId='spring-boot-starter-web'] testdata/repo1`,
+		`testdata/repo1/storage
+`,
+	},
+	{
+		`-c mvn.xml --check-xpath /m:project/m:packaging!='war' --xml-ns m=http://maven.apache.org/POM/4.0.0 testdata/repo1`,
+		"",
+	},
+	{
+		`-c gradle.properties --check-key org.gradle.jvmargs testdata/repo1`,
+		`testdata/repo1/outbound/australia
+`,
+	},
+	{
+		`-f build.gradle -c gradle.properties --check-key org.gradle.jvmargs=~Xmx[0-9]+g --check-key org.gradle.caching==true -i testdata/repo1`,
+		`testdata/repo1/outbound/china/sars
+`,
+	},
+	{
+		`--depends-on mocha<11 testdata/repo1`,
+		`testdata/repo1/inbound
+`,
+	},
+	{
+		`--depends-on mocha>=11 testdata/repo1`,
+		"",
+	},
+	{
+		`-f build.gradle* --depends-on com.amazonaws:aws-java-sdk-s3 --depends-on org.apache.logging.log4j:log4j-core<2.17 testdata/repo1`,
+		`testdata/repo1/outbound/usa
+`,
+	},
+	{
+		`-w has("build.gradle") --depends-on com.amazonaws:aws-java-sdk-s3<1.12 --json testdata/repo1`,
+		`[
+  {
+    "root": "testdata/repo1",
+    "path": "testdata/repo1/outbound/china/sars",
+    "depth": 3,
+    "flagFiles": {},
+    "dependencies": [
+      {
+        "file": "testdata/repo1/outbound/china/sars/build.gradle",
+        "name": "com.amazonaws:aws-java-sdk-s3",
+        "version": "1.11.1000"
+      }
+    ]
+  }
+]
+`,
+	},
+	{
+		`-w has("serverless.yml") -c package.json testdata/repo1`,
+		`testdata/repo1/inbound
+testdata/repo1/outbound/New Zealand
+`,
+	},
+	{
+		`-f china --flag-type d testdata/repo1`,
+		`testdata/repo1/outbound
+`,
+	},
+	{
+		`-f china --flag-type f,l testdata/repo1`,
+		"",
+	},
+	{
+		`-f sars -f package.json -a --flag-type fd testdata/repo1`,
+		`testdata/repo1/outbound/china
+`,
+	},
+	{
+		`-f china/sars testdata/repo1`,
+		`testdata/repo1/outbound
+`,
+	},
+	{
+		`-f **/build.gradle* -s testdata/repo1/outbound`,
+		`testdata/repo1/outbound/australia
+testdata/repo1/outbound/china
+testdata/repo1/outbound/china/sars
+testdata/repo1/outbound/usa
+`,
+	},
+	{
+		`-f sars/build.gradle -f package.json -a --json testdata/repo1`,
+		`[
+  {
+    "root": "testdata/repo1",
+    "path": "testdata/repo1/outbound/china",
+    "depth": 2,
+    "flagFiles": {
+      "package.json": [
+        "package.json"
+      ],
+      "sars/build.gradle": [
+        "sars/build.gradle"
+      ]
+    }
+  }
+]
+`,
+	},
+	{
+		`-c china/*/build.gradle* -e aws-java-sdk testdata/repo1`,
+		`testdata/repo1/outbound
+`,
+	},
+	{
+		`-f build.gradle* --non-empty testdata/repo1`,
+		`testdata/repo1/outbound/china/sars
+testdata/repo1/outbound/usa
+`,
+	},
+	{
+		`-f gradlew --not-executable testdata/repo1`,
+		`testdata/repo1/outbound/usa
+`,
+	},
+	{
+		`-f gradlew --executable testdata/repo1`,
+		"",
+	},
+	{
+		`-f package.json --min-size 1k --max-size 2KB testdata/repo1`,
+		`testdata/repo1/inbound
+`,
+	},
+	{
+		`-f package.json --newer-than 36500d --max-size 0 testdata/repo1`,
+		`testdata/repo1
+testdata/repo1/outbound/New Zealand
+testdata/repo1/outbound/china
+testdata/repo1/outbound/china/mainland
+`,
+	},
+	{
+		`-f package.json --older-than 36500d testdata/repo1`,
+		"",
+	},
+	{
+		`-f *gradle* --min-count 2 testdata/repo1`,
+		`testdata/repo1/outbound/australia
+testdata/repo1/outbound/usa
+`,
+	},
+	{
+		`-f *.{json,yml} --min-count 2 --max-count 2 testdata/repo1`,
+		`testdata/repo1/inbound
+testdata/repo1/outbound/New Zealand
+`,
+	},
+	{
+		`-f *.{json,yml} --max-count 1 -s testdata/repo1/outbound`,
+		`testdata/repo1/outbound/australia
+testdata/repo1/outbound/china
+testdata/repo1/outbound/china/mainland
+`,
+	},
+	{
+		`-f package.json --ancestor-having package.json -s testdata/repo1/outbound`,
+		`testdata/repo1/outbound/china/mainland
+`,
+	},
+	{
+		`-f package.json --ancestor-having serverless.yml testdata/repo1`,
+		"",
+	},
+	{
+		`-f build.gradle* -c gradle.properties --check-upward -e caching testdata/repo1`,
+		`testdata/repo1/outbound/australia
+`,
+	},
+	{
+		`-f build.gradle -c package.json --check-upward --json testdata/repo1/outbound/china`,
+		`[
+  {
+    "root": "testdata/repo1/outbound/china",
+    "path": "testdata/repo1/outbound/china/sars",
+    "depth": 1,
+    "flagFiles": {
+      "build.gradle": [
+        "build.gradle"
+      ]
+    },
+    "checks": [
+      {
+        "file": "testdata/repo1/outbound/china/package.json",
+        "outcome": "matched"
+      }
+    ]
+  }
+]
+`,
+	},
+	{
+		`-f package.json --descendant-having serverless.* testdata/repo1`,
+		`testdata/repo1
+testdata/repo1/inbound
+testdata/repo1/outbound/New Zealand
+testdata/repo1/outbound/china
+`,
+	},
+	{
+		`-f package.json --descendant-having serverless.* --descendant-depth 1 testdata/repo1`,
+		`testdata/repo1/inbound
+testdata/repo1/outbound/New Zealand
+`,
+	},
+	{
+		`-f package.json --descendant-having serverless.yml --descendant-having *.gradle --descendant-depth 2 testdata/repo1`,
+		"",
+	},
+	{
+		`-f package.json --descendant-having serverless.yml --descendant-having *.gradle --descendant-depth 3 testdata/repo1`,
+		`testdata/repo1
+`,
+	},
+	{
+		`-f package.json --dir-name china testdata/repo1`,
+		`testdata/repo1/outbound/china
+`,
+	},
+	{
+		`-f package.json --dir-name c* --dir-name N* testdata/repo1`,
+		`testdata/repo1/outbound/New Zealand
+testdata/repo1/outbound/china
+`,
+	},
+	{
+		`-f *.gradle* --path-regexp outbound/[a-z]+$ testdata/repo1`,
+		`testdata/repo1/outbound/australia
+testdata/repo1/outbound/usa
+`,
+	},
+	{
+		`-f package.json --dir-name mainland testdata/repo1/outbound/china/mainland`,
+		`testdata/repo1/outbound/china/mainland
+`,
+	},
+	{
+		`-f serverless.yml --check-cmd true testdata/repo1`,
+		`testdata/repo1/inbound
+testdata/repo1/outbound/New Zealand
+testdata/repo1/outbound/australia
+`,
+	},
+	{
+		`-f serverless.yml --check-cmd false testdata/repo1`,
+		"",
+	},
+	{
+		`-c ../{dirname}/package.json testdata/repo1`,
+		`testdata/repo1
+testdata/repo1/inbound
+testdata/repo1/outbound/New Zealand
+testdata/repo1/outbound/china
+testdata/repo1/outbound/china/mainland
+`,
+	},
+	{
+		`-f package.json -c ../../{parent}/package.json testdata/repo1`,
+		`testdata/repo1/inbound
+testdata/repo1/outbound/china/mainland
+`,
+	},
+	{
+		`-f package.json -c package.json --check-nearest-ancestor testdata/repo1`,
+		`testdata/repo1/inbound
+testdata/repo1/outbound/New Zealand
+testdata/repo1/outbound/china
+testdata/repo1/outbound/china/mainland
+`,
+	},
+	{
+		`-w has("package.json") --dir-name china testdata/repo1`,
+		"testdata/repo1/outbound/china\n",
+	},
+	{
+		`-w has("package.json") --path-regexp mainland$ testdata/repo1`,
+		"testdata/repo1/outbound/china/mainland\n",
+	},
+	{
+		`-f package.json --check-cmd true --check-cmd-timeout 1ns --error panic -w has("nothing") testdata/repo1`,
+		"", // the check command would time out if it were run
+	},
+	{
+		`-f package.json --check-cmd true -w !has("serverless.yml") testdata/repo1`,
+		`testdata/repo1
+testdata/repo1/outbound/china
+testdata/repo1/outbound/china/mainland
 `,
 	},
 	{
@@ -284,6 +865,161 @@ var invalidArgumentsAndExpectedOutputs = []struct {
 		"",
 		"Error: stat testdata/non-existing-dir: no such file or directory\n",
 	},
+	{
+		`-f package.json --error print testdata/non-existing-dir testdata/repo1/inbound`,
+		"testdata/repo1/inbound\n",
+		"Error: stat testdata/non-existing-dir: no such file or directory\n",
+	},
+	{
+		`-w has("package.json")&&&has("serverless.*") testdata/repo1`,
+		"",
+		"Error: invalid query at position 22: expecting a condition but found \"&\"\n",
+	},
+	{
+		`-c package.json --check-path .version=~( testdata/repo1`,
+		"",
+		"Error: invalid path expression \".version=~(\": error parsing regexp: missing closing ): `(`\n",
+	},
+	{
+		`-c mvn.xml --check-xpath /m:project testdata/repo1`,
+		"",
+		"Error: invalid XPath expression \"/m:project\" at position 2: namespace prefix \"m\" is not mapped\n",
+	},
+	{
+		`-c mvn.xml --xml-ns m testdata/repo1`,
+		"",
+		"Error: invalid XML namespace mapping \"m\", it should be like prefix=uri\n",
+	},
+	{
+		`-c gradle.properties --check-key [gradle testdata/repo1`,
+		"",
+		"Error: invalid key expression \"[gradle\": missing \"]\"\n",
+	},
+	{
+		`--depends-on mocha=11 testdata/repo1`,
+		"",
+		"Error: invalid dependency constraint \"mocha=11\": expecting <, <=, >, >=, == or != but found \"=11\"\n",
+	},
+	{
+		`-f src --flag-type dx testdata/repo1`,
+		"",
+		"Error: invalid flag file type 'x' in \"dx\", it should be f, d or l\n",
+	},
+	{
+		`-f src//java testdata/repo1`,
+		"",
+		"Error: invalid path pattern \"src//java\": empty segment\n",
+	},
+	{
+		`-f package.json --min-size 10x testdata/repo1`,
+		"",
+		"Error: invalid size \"10x\", it should be like 100, 10k, 2M or 1G\n",
+	},
+	{
+		`-f package.json --newer-than 30days testdata/repo1`,
+		"",
+		"Error: invalid age \"30days\", it should be like 30d, 2w, 1y or 12h\n",
+	},
+	{
+		`-f gradlew --executable --not-executable testdata/repo1`,
+		"",
+		"Error: --executable and --not-executable can't be used together\n",
+	},
+	{
+		`-f anything --min-count 3 --max-count 2 testdata/repo1`,
+		"",
+		"Error: --max-count must not be less than --min-count\n",
+	},
+	{
+		`-f anything --descendant-having anything --descendant-depth 0 testdata/repo1`,
+		"",
+		"Error: --descendant-depth must not be 0\n",
+	},
+	{
+		`-f package.json --path-regexp (x testdata/repo1`,
+		"",
+		"Error: error parsing regexp: missing closing ): `(x`\n",
+	},
+	{
+		`-f serverless.yml -d 1 --check-cmd true --check-cmd-timeout 1ns --error panic testdata/repo1`,
+		"",
+		"Error: run \"true\" in testdata/repo1/inbound: timed out after 1ns\n",
+	},
+	{
+		`-f {dirname}[ testdata/repo1`,
+		"",
+		"Error: invalid pattern \"{dirname}[\": unexpected end of input\n",
+	},
+	{
+		`-f a[b testdata/repo1`,
+		"",
+		"Error: invalid flag file glob \"a[b\": unexpected end of input\n",
+	},
+	{
+		`-f package.json -c a[b testdata/repo1`,
+		"",
+		"Error: invalid check file glob \"a[b\": unexpected end of input\n",
+	},
+	{
+		`-f package.json --check-path .scripts.test testdata/repo1`,
+		"",
+		"Error: --check-path requires -c/--check-file\n",
+	},
+	{
+		`-f package.json --check-key a.b testdata/repo1`,
+		"",
+		"Error: --check-key requires -c/--check-file\n",
+	},
+	{
+		`-f package.json --check-xpath /project testdata/repo1`,
+		"",
+		"Error: --check-xpath requires -c/--check-file\n",
+	},
+	{
+		`-f package.json --check-upward testdata/repo1`,
+		"",
+		"Error: --check-upward requires -c/--check-file\n",
+	},
+	{
+		`-f package.json --check-nearest-ancestor testdata/repo1`,
+		"",
+		"Error: --check-nearest-ancestor requires -c/--check-file\n",
+	},
+	{
+		`-f package.json --not-having [a testdata/repo1`,
+		"",
+		"Error: invalid --not-having glob \"[a\": unexpected end of input\n",
+	},
+	{
+		`-f package.json -x [a testdata/repo1`,
+		"",
+		"Error: invalid -x/--exclude glob \"[a\": unexpected end of input\n",
+	},
+	{
+		`-c package.json -e ( testdata/repo1`,
+		"",
+		"Error: invalid check regexp \"(\": error parsing regexp: missing closing ): `(`\n",
+	},
+	{
+		`-f package.json --ancestor-having [a testdata/repo1`,
+		"",
+		"Error: invalid --ancestor-having glob \"[a\": unexpected end of input\n",
+	},
+	{
+		`-f package.json --descendant-having [a testdata/repo1`,
+		"",
+		"Error: invalid --descendant-having glob \"[a\": unexpected end of input\n",
+	},
+	{
+		`-f package.json --dir-name [a testdata/repo1`,
+		"",
+		"Error: invalid --dir-name glob \"[a\": unexpected end of input\n",
+	},
+	{
+		`-f anything --error panic -j 4 testdata/non-existing-dir`,
+		"",
+		"Error: stat testdata/non-existing-dir: no such file or directory\n",
+	},
 }
 
 func TestDoMainWithValidArguments(t *testing.T) {
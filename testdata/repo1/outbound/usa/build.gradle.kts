@@ -0,0 +1,9 @@
+plugins {
+    java
+}
+
+dependencies {
+    implementation("com.amazonaws:aws-java-sdk-s3:1.12.261")
+    implementation("org.apache.logging.log4j:log4j-core:2.14.1")
+    testImplementation("junit:junit:4.13.2")
+}